@@ -20,17 +20,16 @@
 package cmd
 
 import (
-	"fmt"
+	"context"
+	"io"
 	"github.com/pkg/errors"
 	"path/filepath"
 
     log "github.com/sirupsen/logrus"
 
-	"github.com/gosuri/uitable"
 	"github.com/uniknow/helm-outdated/pkg/helm"
 	"github.com/spf13/cobra"
 
-	"helm.sh/helm/v3/pkg/cli"
 )
 
 var listLongUsage = `
@@ -46,15 +45,25 @@ type listCmd struct {
 	maxColumnWidth             uint
 	chartPath                  string
 	failOnOutdatedDependencies bool
+	failOnDeprecated           bool
+	failOnErrors               bool
+	failThreshold              helm.IncType
+	output                     helm.OutputFormat
+	template                   *helm.Template
+	out                        io.Writer
 	dependencyFilter *helm.Filter
+	policy           *helm.Policy
+	repoOptions      *helm.RepositoryOptions
 }
 
 func newListOutdatedDependenciesCmd() *cobra.Command {
 	l := &listCmd{
 		dependencyFilter: &helm.Filter{},
+		policy:           &helm.Policy{},
 		maxColumnWidth:   60,
 	}
 
+	var failThreshold string
 	cmd := &cobra.Command{
 		Use:          "list",
 		Long:         listLongUsage,
@@ -91,45 +100,92 @@ func newListOutdatedDependenciesCmd() *cobra.Command {
 				l.dependencyFilter.DependencyNames = deps
 			}
 
-			return l.list()
+			if err := parsePolicy(cmd, l.chartPath, l.policy); err != nil {
+				return err
+			}
+
+			repoOptions, err := parseRepositoryOptions(cmd)
+			if err != nil {
+				return err
+			}
+			l.repoOptions = repoOptions
+
+			if l.output, l.template, err = parseOutputFormat(cmd); err != nil {
+				return err
+			}
+			l.out = cmd.OutOrStdout()
+
+			if l.failThreshold, err = helm.ParseIncType(failThreshold); err != nil {
+				return err
+			}
+
+			ctx, cancel := newContext(cmd)
+			defer cancel()
+			return l.list(ctx)
 		},
 	}
 
 	addCommonFlags(cmd)
 	cmd.Flags().BoolVarP(&l.failOnOutdatedDependencies, "fail-on-outdated-dependencies", "", false, "Fail if any dependency is outdated. (exit code 1)")
+	cmd.Flags().BoolVar(&l.failOnDeprecated, "fail-on-deprecated", false, "Fail if any dependency, its version or repository is deprecated. (exit code 1)")
+	cmd.Flags().StringVar(&failThreshold, "fail-threshold", string(helm.IncTypes.Patch), "Only treat dependencies as outdated for --fail-on-outdated-dependencies and -o junit if the latest version is at least this change away: patch, minor or major.")
+	cmd.Flags().BoolVar(&l.failOnErrors, "fail-on-errors", false, "Fail if any dependency could not be checked, e.g. because its repository is unreachable. (exit code 1)")
 
 	return cmd
 }
 
-func (l *listCmd) list() error {
-	outdatedDeps, err := helm.ListOutdatedDependencies(l.chartPath, cli.New(), l.dependencyFilter)
+func (l *listCmd) list(ctx context.Context) error {
+	report, err := newChecker(l.dependencyFilter, l.policy, l.repoOptions).Check(ctx, l.chartPath)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(l.formatResults(outdatedDeps))
+	// Dependencies using the latest version are not listed unless a newer version is in cooldown.
+	var outdatedDeps []*helm.Result
+	for _, r := range report.Results {
+		if r.IsOutdated() || r.Deprecation != nil || r.Failed() || r.Status == helm.Statuses.Unknown || r.Cooldown != nil {
+			outdatedDeps = append(outdatedDeps, r)
+		}
+	}
 
-	if l.failOnOutdatedDependencies && len(outdatedDeps) > 0 {
-		return errors.New("dependencies are outdated")
+	// JUnit reports have a test case for every dependency.
+	results := outdatedDeps
+	if l.output == helm.OutputFormats.JUnit {
+		results = report.Results
 	}
 
-	return nil
-}
+	if err := helm.WriteOutput(l.out, l.output, l.chartPath, results, helm.OutputOptions{
+		Title:          "The following dependencies are outdated, deprecated or could not be checked:",
+		MaxColumnWidth: l.maxColumnWidth,
+		FailThreshold:  l.failThreshold,
+		Template:       l.template,
+	}); err != nil {
+		return err
+	}
+
+	if l.failOnErrors {
+		for _, r := range outdatedDeps {
+			if r.Failed() {
+				return errors.New("dependencies could not be checked")
+			}
+		}
+	}
 
-func (l *listCmd) formatResults(results []*helm.Result) string {
-	if len(results) == 0 {
-		return "All charts up to date."
+	if l.failOnDeprecated {
+		for _, r := range outdatedDeps {
+			if r.Deprecation != nil {
+				return errors.New("dependencies are deprecated")
+			}
+		}
 	}
-	table := uitable.New()
-	table.MaxColWidth = l.maxColumnWidth
-	table.AddRow("The following dependencies are outdated:")
-	table.AddRow("ALIAS", "VERSION", "LATEST_VERSION", "REPOSITORY")
-	for _, r := range results {
-		name := r.Alias
-		if name == "" {
-			name = r.Name
+
+	if l.failOnOutdatedDependencies {
+		for _, r := range outdatedDeps {
+			if r.IsOutdatedBeyond(l.failThreshold) {
+				return errors.New("dependencies are outdated")
+			}
 		}
-		table.AddRow(name, r.Version, r.LatestVersion, r.Repository)
 	}
-	return table.String()
+
+	return nil
 }
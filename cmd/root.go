@@ -20,7 +20,16 @@
 package cmd
 
 import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/uniknow/helm-outdated/pkg/helm"
+	"helm.sh/helm/v3/pkg/cli"
 )
 
 var rootCmdLongUsage = `
@@ -51,7 +60,170 @@ func New() *cobra.Command {
 
 func addCommonFlags(cmd *cobra.Command) {
 	cmd.Flags().IntP("max-column-width", "w", 60, "Max column width to use for tables")
-	cmd.Flags().StringSliceP("repositories", "r", []string{}, "Limit search to the given repository URLs. Can also just provide a part of the URL.")
+	cmd.Flags().StringSliceP("repositories", "r", []string{}, "Limit search to the given repositories. Can be the name of a repository configured via helm repo add or a part of its URL.")
 	cmd.Flags().StringSliceP("dependencies", "", []string{}, "Only considers the given dependencies.")
+	cmd.Flags().String("max-bump", string(helm.IncTypes.Major), "Only considers versions up to the given change of the current version: patch, minor or major.")
+	cmd.Flags().String("prereleases", string(helm.PrereleasePolicies.IfCurrentIsPrerelease), "Whether pre-release versions are considered: never, if-current-is-prerelease or always.")
+	cmd.Flags().StringToString("dependency-prereleases", map[string]string{}, "Pre-release policy for single dependencies by name or alias, e.g. nginx=always.")
+	cmd.Flags().Duration("min-release-age", 0, "Only considers versions published at least this long ago, e.g. 72h.")
+	cmd.Flags().Bool("offline", false, "Do not download repository indexes, only use the ones found in the repository cache.")
+	cmd.Flags().Duration("index-max-age", 0, "Use downloaded repository indexes for this long without checking the repository for changes, e.g. 1h.")
+	cmd.Flags().Duration("timeout", 5*time.Minute, "Time to wait for repositories. Dependencies of repositories which do not respond in time are reported as unreachable. 0 waits forever.")
+	cmd.Flags().Int("concurrency", 8, "Number of repositories updated and dependencies resolved at the same time.")
+	cmd.Flags().String("username", "", "Username for repositories which are not configured via helm repo add.")
+	cmd.Flags().Bool("password-stdin", false, "Read the password for repositories which are not configured via helm repo add from stdin.")
+	cmd.Flags().String("cert-file", "", "Client certificate file for repositories which are not configured via helm repo add.")
+	cmd.Flags().String("key-file", "", "Client key file for repositories which are not configured via helm repo add.")
+	cmd.Flags().String("ca-file", "", "CA bundle to verify the certificates of repositories which are not configured via helm repo add.")
+	cmd.Flags().Bool("insecure-skip-tls-verify", false, "Skip the verification of certificates of repositories which are not configured via helm repo add.")
+	cmd.Flags().Bool("plain-http", false, "Access OCI registries via HTTP instead of HTTPS.")
+	cmd.Flags().String("config", "", "Path of the configuration file. Defaults to "+helm.ConfigFileName+" in the chart directory or the root of the git repository.")
 	cmd.Flags().Bool("debug",false,"Enable debug")
+	cmd.Flags().StringP("output", "o", string(helm.OutputFormats.Table), "Output format: table, json, yaml, sarif, junit, markdown or template. Progress is written to stderr.")
+	cmd.Flags().String("template", "", "Render the results with the Go template in the given file or the given inline template, which may use the sprig functions. Implies -o template.")
+}
+
+// parsePolicy reads the policy from the configuration file of the chart and the flags added by addCommonFlags.
+// Flags which are set explicitly take precedence over the configuration file.
+func parsePolicy(cmd *cobra.Command, chartPath string, policy *helm.Policy) error {
+	configFile, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return err
+	}
+	if configFile == "" {
+		if configFile, err = helm.FindConfigFile(chartPath); err != nil {
+			return err
+		}
+	}
+	if configFile != "" {
+		log.Debugf("Loading configuration file %s", configFile)
+		config, err := helm.LoadConfigFile(configFile)
+		if err != nil {
+			return err
+		}
+		*policy = *config
+	}
+
+	if maxBump, err := cmd.Flags().GetString("max-bump"); err == nil && (cmd.Flags().Changed("max-bump") || policy.MaxBump == "") {
+		if policy.MaxBump, err = helm.ParseIncType(maxBump); err != nil {
+			return err
+		}
+	}
+
+	if prereleases, err := cmd.Flags().GetString("prereleases"); err == nil && (cmd.Flags().Changed("prereleases") || policy.Prereleases == "") {
+		if policy.Prereleases, err = helm.ParsePrereleasePolicy(prereleases); err != nil {
+			return err
+		}
+	}
+
+	if minReleaseAge, err := cmd.Flags().GetDuration("min-release-age"); err == nil && (cmd.Flags().Changed("min-release-age") || policy.MinReleaseAge == 0) {
+		policy.MinReleaseAge = minReleaseAge
+	}
+
+	if depPrereleases, err := cmd.Flags().GetStringToString("dependency-prereleases"); err == nil {
+		for name, value := range depPrereleases {
+			prereleases, err := helm.ParsePrereleasePolicy(value)
+			if err != nil {
+				return err
+			}
+
+			if policy.Dependencies == nil {
+				policy.Dependencies = map[string]*helm.Policy{}
+			}
+			if policy.Dependencies[name] == nil {
+				policy.Dependencies[name] = &helm.Policy{}
+			}
+			policy.Dependencies[name].Prereleases = prereleases
+			if rule := policy.Dependencies[name].Rule; rule != "" {
+				policy.Dependencies[name].Rule = rule + ", --dependency-prereleases"
+			} else {
+				policy.Dependencies[name].Rule = "--dependency-prereleases"
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseRepositoryOptions reads the repository options from the flags added by addCommonFlags.
+// The password for repositories which are not configured is read from stdin if requested.
+func parseRepositoryOptions(cmd *cobra.Command) (*helm.RepositoryOptions, error) {
+	offline, _ := cmd.Flags().GetBool("offline")
+	plainHTTP, _ := cmd.Flags().GetBool("plain-http")
+	indexMaxAge, _ := cmd.Flags().GetDuration("index-max-age")
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	if concurrency < 1 {
+		return nil, errors.Errorf("invalid concurrency %d, must be at least 1", concurrency)
+	}
+
+	c := &helm.RepositoryCredentials{}
+	c.Username, _ = cmd.Flags().GetString("username")
+	c.CertFile, _ = cmd.Flags().GetString("cert-file")
+	c.KeyFile, _ = cmd.Flags().GetString("key-file")
+	c.CAFile, _ = cmd.Flags().GetString("ca-file")
+	c.InsecureSkipTLSVerify, _ = cmd.Flags().GetBool("insecure-skip-tls-verify")
+
+	if passwordStdin, _ := cmd.Flags().GetBool("password-stdin"); passwordStdin {
+		if c.Username == "" {
+			return nil, errors.New("--password-stdin requires --username")
+		}
+		password, err := ioutil.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the password from stdin")
+		}
+		c.Password = strings.TrimRight(string(password), "\r\n")
+	}
+	return &helm.RepositoryOptions{Credentials: c, Offline: offline, IndexMaxAge: indexMaxAge, PlainHTTP: plainHTTP, Concurrency: concurrency}, nil
+}
+
+// parseOutputFormat reads the output format and the template from the flags added by addCommonFlags.
+func parseOutputFormat(cmd *cobra.Command) (helm.OutputFormat, *helm.Template, error) {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return "", nil, err
+	}
+	format, err := helm.ParseOutputFormat(output)
+	if err != nil {
+		return "", nil, err
+	}
+
+	value, err := cmd.Flags().GetString("template")
+	if err != nil {
+		return "", nil, err
+	}
+	if value == "" {
+		if format == helm.OutputFormats.Template {
+			return "", nil, errors.New("-o template requires --template")
+		}
+		return format, nil, nil
+	}
+
+	if cmd.Flags().Changed("output") && format != helm.OutputFormats.Template {
+		return "", nil, errors.Errorf("--template cannot be combined with -o %s", format)
+	}
+	tmpl, err := helm.LoadTemplate(value)
+	if err != nil {
+		return "", nil, err
+	}
+	return helm.OutputFormats.Template, tmpl, nil
+}
+
+// newChecker returns the checker used by the commands. Its output is written by the standard logger.
+func newChecker(filter *helm.Filter, policy *helm.Policy, repoOptions *helm.RepositoryOptions) *helm.Checker {
+	return helm.NewChecker(helm.Options{
+		Settings:     cli.New(),
+		Filter:       filter,
+		Policy:       policy,
+		Repositories: repoOptions,
+		Logger:       log.StandardLogger(),
+	})
+}
+
+// newContext returns the context for checking dependencies, which is done after the timeout set by the flag added by
+// addCommonFlags.
+func newContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	if timeout, _ := cmd.Flags().GetDuration("timeout"); timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
 }
@@ -20,7 +20,10 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"path/filepath"
 	"strings"
 	"time"
@@ -28,20 +31,23 @@ import (
 
     log "github.com/sirupsen/logrus"
 
-	"github.com/gosuri/uitable"
 	"github.com/uniknow/helm-outdated/pkg/git"
 	"github.com/uniknow/helm-outdated/pkg/helm"
 	"github.com/spf13/cobra"
 
-	"helm.sh/helm/v3/pkg/cli"
 )
 
 type updateCmd struct {
 	chartPath               string
 	maxColumnWidth          uint
-	indent                  int
 	isIncrementChartVersion bool
+	strategy                string
+	output                  helm.OutputFormat
+	template                *helm.Template
+	out, errOut             io.Writer
 	dependencyFilter        *helm.Filter
+	policy                  *helm.Policy
+	repoOptions             *helm.RepositoryOptions
 	git                     *git.Git
 	hub                     *git.Hub
 
@@ -50,7 +56,9 @@ type updateCmd struct {
 	isAutoUpdate,
 	isOnlyPullRequest bool
 	authorName,
-	authorEmail string
+	authorEmail,
+	commitMessageTemplate,
+	pullRequestTitleTemplate string
 }
 
 var updateLongUsage = `
@@ -67,6 +75,7 @@ Examples:
 func newUpdateOutdatedDependenciesCmd() *cobra.Command {
 	u := &updateCmd{
 		dependencyFilter: &helm.Filter{},
+		policy:           &helm.Policy{},
 		maxColumnWidth:   60,
 	}
 
@@ -106,46 +115,105 @@ func newUpdateOutdatedDependenciesCmd() *cobra.Command {
 			}
 			u.chartPath = path
 
-			return u.update()
+			if err := parsePolicy(cmd, u.chartPath, u.policy); err != nil {
+				return err
+			}
+
+			repoOptions, err := parseRepositoryOptions(cmd)
+			if err != nil {
+				return err
+			}
+			u.repoOptions = repoOptions
+
+			if u.output, u.template, err = parseOutputFormat(cmd); err != nil {
+				return err
+			}
+			u.out, u.errOut = cmd.OutOrStdout(), cmd.ErrOrStderr()
+
+			ctx, cancel := newContext(cmd)
+			defer cancel()
+			return u.update(ctx)
 		},
 	}
 
 	addCommonFlags(cmd)
 	cmd.Flags().BoolVarP(&u.isIncrementChartVersion, "increment-chart-version", "", false, "Increment the version of the Helm chart if requirements are updated.")
-	cmd.Flags().IntVarP(&u.indent, "indent", "", 4, "Indent to use when writing the requirements.yaml .")
+	cmd.Flags().StringVar(&u.strategy, "strategy", string(helm.UpdateStrategies.Pin), "How to update the version of a dependency: pin (exact version), preserve-range (move the constraint, e.g. ~1.2.0 to ~1.4.0) or widen (add the moved constraint, e.g. ~1.2.0 || ~1.4.0).")
+	cmd.Flags().Int("indent", 4, "Indent to use when writing the requirements.yaml .")
+	cmd.Flags().MarkDeprecated("indent", "the formatting of the Chart.yaml and requirements.yaml is preserved when updating dependencies")
 
 	// **Experimental** Update dependencies of the given chart, commit and push to upstream using git.
 	cmd.Flags().BoolVar(&u.isAutoUpdate, "auto-update", false, "**Experimental** Update dependencies of the given chart, commit and push to upstream using git.")
 	cmd.Flags().StringVar(&u.authorName, "author-name", "", "The name of the author and committer to be used when auto update is enabled.")
 	cmd.Flags().StringVar(&u.authorEmail, "author-email", "", "The email of the author and committer to be used when auto update is enabled.")
 	cmd.Flags().BoolVar(&u.isOnlyPullRequest, "only-pull-requests", false, "Only use pull requests. Do not commit minor changes to master branch.")
+	cmd.Flags().StringVar(&u.commitMessageTemplate, "commit-message-template", helm.DefaultCommitMessageTemplate, "Go template file or inline template of the commit message when auto update is enabled.")
+	cmd.Flags().StringVar(&u.pullRequestTitleTemplate, "pr-title-template", helm.DefaultPullRequestTitleTemplate, "Go template file or inline template of the title of pull requests when auto update is enabled.")
 
 	return cmd
 }
 
-func (u *updateCmd) update() error {
-	outdatedDeps, err := helm.ListOutdatedDependencies(u.chartPath, cli.New(), u.dependencyFilter)
+func (u *updateCmd) update(ctx context.Context) error {
+	strategy, err := helm.ParseUpdateStrategy(u.strategy)
 	if err != nil {
 		return err
 	}
 
+	// Invalid templates are rejected before the chart is changed.
+	var commitMessageTmpl, pullRequestTitleTmpl *helm.Template
+	if u.isAutoUpdate {
+		if commitMessageTmpl, err = helm.LoadTemplate(u.commitMessageTemplate); err != nil {
+			return err
+		}
+		if pullRequestTitleTmpl, err = helm.LoadTemplate(u.pullRequestTitleTemplate); err != nil {
+			return err
+		}
+	}
+
+	checker := newChecker(u.dependencyFilter, u.policy, u.repoOptions)
+	report, err := checker.Check(ctx, u.chartPath)
+	if err != nil {
+		return err
+	}
+
+	// All dependencies are listed, but only outdated ones are updated.
+	for _, r := range report.Results {
+		if r.Failed() {
+			log.Warnf("Dependency %s could not be checked: %s (%s)", r.Name, r.Status, r.Err.Error())
+		} else if r.Status == helm.Statuses.Unknown {
+			log.Warnf("Latest version of dependency %s is unknown: %s", r.Name, r.Err.Error())
+		} else if !r.IsOutdated() && r.Deprecation != nil {
+			log.Warnf("Dependency %s is deprecated: %s", r.Name, r.Deprecation.String())
+		}
+	}
+
+	plan := report.Plan(strategy)
+	outdatedDeps := plan.Updates
+
+	// The chart is not up to date if nothing is updated because dependencies could not be checked.
+	results, title := outdatedDeps, "Updating the following dependencies to their latest version:"
+	if failedDeps := report.Failed(); len(outdatedDeps) == 0 && len(failedDeps) > 0 {
+		results, title = failedDeps, "The following dependencies could not be checked:"
+	}
+	if err := helm.WriteOutput(u.out, u.output, u.chartPath, results, helm.OutputOptions{
+		Title:          title,
+		MaxColumnWidth: u.maxColumnWidth,
+		Template:       u.template,
+	}); err != nil {
+		return err
+	}
 	if len(outdatedDeps) == 0 {
-		fmt.Println("All charts up-to-date.")
 		return nil
 	}
-	fmt.Println(u.formatResults(outdatedDeps))
 
 	if u.isIncrementChartVersion || u.isAutoUpdate {
-	    fmt.Println("UPDATING CHART VERSION")
-		if err = helm.IncrementChartVersion(u.chartPath, helm.IncTypes.Patch); err != nil {
-		    fmt.Println("ERROR OCCURRED WHILE UPDATING CHART VERSION")
-			return err
-		}
+		log.Info("Updating the chart version")
+		plan.IncrementChartVersion = helm.IncTypes.Patch
 	}
 
-	fmt.Println("UPDATING DEPENDENCIES")
-	if err := helm.UpdateDependencies(u.chartPath, outdatedDeps, u.indent); err != nil {
-		fmt.Println("ERROR OCCURRED WHILE UPDATING DEPENDENCIES")
+	log.Info("Updating dependencies")
+	if err := checker.Apply(ctx, plan); err != nil {
+		log.Error("Error occurred while updating dependencies")
 		return err
 	}
 
@@ -156,16 +224,10 @@ func (u *updateCmd) update() error {
 
 	// maxIncType is used to keep track of the version changes when updating dependencies.
 	maxIncType := helm.IncTypes.Patch
-	depNames := make([]string, len(outdatedDeps))
-	for idx, dep := range outdatedDeps {
+	for _, dep := range outdatedDeps {
 		if i := helm.GetIncType(dep.CurrentVersion, dep.LatestVersion); maxIncType.IsGreater(i) {
 			maxIncType = i
 		}
-		depName := dep.Alias
-		if depName == "" {
-			depName = dep.Name
-		}
-		depNames[idx] = fmt.Sprintf("%s@%s",  depName, dep.LatestVersion)
 	}
 
 	chartName, err := helm.GetChartName(u.chartPath)
@@ -173,11 +235,25 @@ func (u *updateCmd) update() error {
 		return err
 	}
 
-	commitMessage := fmt.Sprintf("[%s] updated dependency to %s", chartName, strings.Join(depNames, ", "))
+	commitMessage, err := commitMessageTmpl.Render(u.chartPath, outdatedDeps)
+	if err != nil {
+		return err
+	}
+	commitMessage = strings.TrimSpace(commitMessage)
 
-	// If potential breaking changes are expected, use a pull request.
+	// If potential breaking changes are expected, use a pull request describing them.
 	if u.isOnlyPullRequest || maxIncType == helm.IncTypes.Major || maxIncType == helm.IncTypes.Minor {
-		return u.upstreamMajorChanges(commitMessage, chartName)
+		var description bytes.Buffer
+		if err := helm.WriteOutput(&description, helm.OutputFormats.Markdown, u.chartPath, outdatedDeps, helm.OutputOptions{
+			Title: "Updating the following dependencies to their latest version:",
+		}); err != nil {
+			return err
+		}
+		title, err := pullRequestTitleTmpl.Render(u.chartPath, outdatedDeps)
+		if err != nil {
+			return err
+		}
+		return u.upstreamMajorChanges(commitMessage, strings.TrimSpace(title), description.String(), chartName)
 	}
 
 	return u.upstreamMinorChanges(commitMessage)
@@ -194,21 +270,21 @@ func (u *updateCmd) upstreamMinorChanges(commitMessage string) error {
 	if err != nil {
 		return err
 	}
-	fmt.Println(res)
+	fmt.Fprintln(u.errOut, res)
 
 	res, err = g.Commit(commitMessage)
 	if err != nil {
 		return err
 	}
-	fmt.Println(res)
+	fmt.Fprintln(u.errOut, res)
 
 	res, err = g.RebaseAndPushToMaster()
-	fmt.Println(res)
+	fmt.Fprintln(u.errOut, res)
 	return err
 }
 
-// upstreamMajorChanges same as upstreamMinorChanges but via github.com pull request.
-func (u *updateCmd) upstreamMajorChanges(commitMessage, chartName string) error {
+// upstreamMajorChanges same as upstreamMinorChanges but via github.com pull request with the given title and description.
+func (u *updateCmd) upstreamMajorChanges(commitMessage, title, description, chartName string) error {
 	g, err := git.NewGit(u.chartPath, u.authorName, u.authorEmail)
 	if err != nil {
 		return err
@@ -225,44 +301,26 @@ func (u *updateCmd) upstreamMajorChanges(commitMessage, chartName string) error
 	if err != nil {
 		return err
 	}
-	fmt.Println(res)
+	fmt.Fprintln(u.errOut, res)
 
 	res, err = g.Commit(commitMessage)
 	if err != nil {
 		return err
 	}
-	fmt.Println(res)
+	fmt.Fprintln(u.errOut, res)
 
 	res, err = g.Push(branchName)
 	if err != nil {
 		return err
 	}
-	fmt.Println(res)
+	fmt.Fprintln(u.errOut, res)
 
 	hub, err := git.NewHub(u.chartPath)
 	if err != nil {
 		return err
 	}
 
-	res, err = hub.OpenPullRequestToMaster(branchName, fmt.Sprintf("[%s] updating dependencies", chartName), commitMessage)
-	fmt.Println(res)
+	res, err = hub.OpenPullRequestToMaster(branchName, title, description)
+	fmt.Fprintln(u.errOut, res)
 	return err
 }
-
-func (u *updateCmd) formatResults(results []*helm.Result) string {
-	if len(results) == 0 {
-		return "All charts up to date."
-	}
-	table := uitable.New()
-	table.MaxColWidth = u.maxColumnWidth
-	table.AddRow("Updating the following dependencies to their latest version:")
-	table.AddRow("ALIAS", "VERSION", "LATEST_VERSION", "REPOSITORY")
-	for _, r := range results {
-		name := r.Alias
-		if name == "" {
-			name = r.Name
-		}
-		table.AddRow(name, r.Version, r.LatestVersion, r.Repository)
-	}
-	return table.String()
-}
@@ -52,7 +52,7 @@ func (c *Command) Run(args ...string) (string, error) {
 	cmd := exec.Command(c.cmd, append(c.defaultArgs, args...)...)
 
 	if v, ok := os.LookupEnv("DEBUG"); ok && v == "true" {
-		fmt.Println("running: ", cmd.String())
+		fmt.Fprintln(os.Stderr, "running: ", cmd.String())
 	}
 
 	var (
@@ -0,0 +1,291 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+)
+
+// Options configure a Checker. All fields are optional.
+type Options struct {
+	// Settings locate the repositories.yaml, the repository cache and the registry config of Helm.
+	// Defaults to the settings of the environment.
+	Settings *cli.EnvSettings
+	// Filter limits the checked dependencies.
+	Filter *Filter
+	// Policy limits the proposed versions.
+	Policy *Policy
+	// Repositories control how repositories are accessed.
+	Repositories *RepositoryOptions
+	// Logger receives progress and diagnostics. Defaults to the standard logger of logrus.
+	// Use NopLogger to discard them.
+	Logger Logger
+}
+
+// Checker checks the dependencies of charts and updates them.
+// It never writes to stdout, all output goes to the Logger. A Checker can be used concurrently and shares the parsed
+// repository indexes between all charts it checks. They are released together with the Checker.
+type Checker struct {
+	options Options
+	indexes *indexCache
+}
+
+// NewChecker returns a Checker using the given options.
+func NewChecker(options Options) *Checker {
+	if options.Settings == nil {
+		options.Settings = cli.New()
+	}
+	if options.Filter == nil {
+		options.Filter = &Filter{}
+	}
+	if options.Repositories == nil {
+		options.Repositories = &RepositoryOptions{}
+	}
+	if options.Logger == nil {
+		options.Logger = log.StandardLogger()
+	}
+	return &Checker{options: options, indexes: newIndexCache()}
+}
+
+// Report is the outcome of checking a chart.
+type Report struct {
+	// ChartPath is the path of the checked chart.
+	ChartPath string
+	// Results contains a result for every dependency which is not ignored by the policy, sorted by name.
+	Results []*Result
+	// Repositories contains the status of every chart repository used by the dependencies.
+	// Local charts and OCI registries have no index and are not included.
+	Repositories []*RepositoryStatus
+}
+
+// RepositoryStatus describes the index of a chart repository used by a check.
+type RepositoryStatus struct {
+	// URL of the repository.
+	URL string
+	// Name is the name of the repository in the repositories.yaml of Helm or empty.
+	Name string
+	// Updated is set if the index was downloaded or confirmed to be unchanged. It is never set in offline mode.
+	Updated bool
+	// IndexFile is the path of the cached index or empty if there is none.
+	IndexFile string
+	// Err is the reason why the index could not be updated or found.
+	Err error
+}
+
+// Outdated returns the results of the outdated dependencies.
+func (r *Report) Outdated() []*Result {
+	var res []*Result
+	for _, result := range r.Results {
+		if result.IsOutdated() {
+			res = append(res, result)
+		}
+	}
+	return res
+}
+
+// Failed returns the results of the dependencies which could not be checked.
+func (r *Report) Failed() []*Result {
+	var res []*Result
+	for _, result := range r.Results {
+		if result.Failed() {
+			res = append(res, result)
+		}
+	}
+	return res
+}
+
+// Plan returns the plan to update all outdated dependencies of the chart using the given strategy.
+func (r *Report) Plan(strategy UpdateStrategy) *Plan {
+	return &Plan{
+		ChartPath: r.ChartPath,
+		Updates:   r.Outdated(),
+		Strategy:  strategy,
+	}
+}
+
+// Plan describes the changes made to a chart by Checker.Apply.
+type Plan struct {
+	// ChartPath is the path of the chart to change.
+	ChartPath string
+	// Updates are the dependencies updated to their latest version. Results which are not outdated are skipped.
+	Updates []*Result
+	// Strategy controls how version constraints are updated. Defaults to UpdateStrategies.Pin .
+	Strategy UpdateStrategy
+	// IncrementChartVersion is the part of the version of the chart which is incremented. The version is not changed if
+	// it is empty.
+	IncrementChartVersion IncType
+}
+
+// Check returns the latest versions of the dependencies of the chart in the given path.
+// Dependencies which cannot be checked are reported with the reason in their Result. An error is only returned if the
+// chart or the repositories.yaml cannot be loaded. Repositories which are not updated before the context is done
+// are reported as unreachable.
+func (c *Checker) Check(ctx context.Context, chartPath string) (*Report, error) {
+	ctx = withIndexCache(withLogger(ctx, c.options.Logger), c.indexes)
+	logger, settings, repoOptions := c.options.Logger, c.options.Settings, c.options.Repositories
+
+	// Connections are reused for all repositories of the chart.
+	clients := newHTTPClients()
+	defer clients.closeIdleConnections()
+	ctx = withHTTPClients(ctx, clients)
+
+	repos, err := loadRepositories(ctx, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, chartDeps, err := loadDependencies(chartPath, repos, c.options.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Positions are only used for reports, so charts which cannot be parsed by yaml.v3 are still checked.
+	positions, err := loadDependencyPositions(chartPath, ch)
+	if err != nil {
+		logger.Debugf("Unable to find the positions of the dependencies of %s: %s", chartPath, err)
+	}
+
+	var (
+		deps     []*chart.Dependency
+		policies = map[*chart.Dependency]*Policy{}
+		res      []*Result
+	)
+	for _, dep := range chartDeps {
+		depPolicy := c.options.Policy.forDependency(dep)
+		if depPolicy.Ignore {
+			logger.Infof("Ignoring dependency %s as declared in %s", dep.Name, depPolicy.Rule)
+			continue
+		}
+
+		// Look up the dependency in the preferred repository.
+		if depPolicy.Repository != "" {
+			d := *dep
+			d.Repository = depPolicy.Repository
+			dep = &d
+		}
+
+		// Aliases like @stable refer to repositories configured in the repositories.yaml .
+		repository, err := repos.resolve(dep.Repository)
+		if err != nil {
+			r := newFailedResult(dep, nil, Statuses.Unresolvable, err)
+			r.Policy = depPolicy
+			res = append(res, r)
+			continue
+		}
+		dep.Repository = repository
+
+		deps = append(deps, dep)
+		policies[dep] = depPolicy
+	}
+
+	// Update local cached repositories. In offline mode, missing indexes are reported when resolving the dependencies.
+	var (
+		repoStatuses []*RepositoryStatus
+		failedRepos  map[string]error
+	)
+	if repoOptions.Offline {
+		logger.Infof("Offline mode, only using cached repository indexes")
+		repoStatuses = cachedRepositoryStatuses(deps, repos, settings)
+	} else {
+		repoStatuses = parallelRepoUpdate(ctx, deps, repos, repoOptions, settings)
+		failedRepos = failedRepositories(repoStatuses)
+	}
+
+	res = append(res, resolveDependencies(ctx, deps, policies, repos, settings, repoOptions, failedRepos)...)
+	for _, r := range res {
+		r.Position = positions[dependencyKey(r.Name, r.Alias)]
+	}
+	return &Report{
+		ChartPath:    chartPath,
+		Results:      sortResultsAlphabetically(res),
+		Repositories: repoStatuses,
+	}, nil
+}
+
+// Apply changes the chart as described by the plan. Either all changes are written or none of them.
+// The formatting and comments of the changed files are preserved.
+func (c *Checker) Apply(ctx context.Context, plan *Plan) error {
+	strategy := plan.Strategy
+	if strategy == "" {
+		strategy = UpdateStrategies.Pin
+	}
+
+	w, err := newChartWriter(plan.ChartPath, c.options.Logger)
+	if err != nil {
+		return err
+	}
+
+	if plan.IncrementChartVersion != "" {
+		if err := w.IncrementChartVersion(plan.IncrementChartVersion); err != nil {
+			return err
+		}
+	}
+
+	if len(plan.Updates) > 0 {
+		c.options.Logger.Infof("Updating outdated dependencies of chart %s", plan.ChartPath)
+		if err := w.UpdateDependencies(plan.Updates, strategy); err != nil {
+			return err
+		}
+	}
+
+	// Nothing is written if the caller gave up in the meantime.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return w.Commit()
+}
+
+// failedRepositories returns the errors of the repositories which failed to update by URL.
+func failedRepositories(statuses []*RepositoryStatus) map[string]error {
+	res := map[string]error{}
+	for _, s := range statuses {
+		if s.Err != nil {
+			res[s.URL] = s.Err
+		}
+	}
+	return res
+}
+
+// chartRepositories returns the URLs of the repositories of the dependencies whose version source has an index.
+func chartRepositories(deps []*chart.Dependency) []string {
+	var repos []string
+	for _, dep := range deps {
+		// Local charts and OCI registries have no index file.
+		if _, ok := versionSourceFor(dep.Repository).(IndexUpdater); ok && !stringSliceContains(repos, dep.Repository) {
+			repos = append(repos, dep.Repository)
+		}
+	}
+	return repos
+}
+
+// cachedRepositoryStatuses returns the status of the cached indexes of the repositories of the dependencies.
+func cachedRepositoryStatuses(deps []*chart.Dependency, repos repositories, settings *cli.EnvSettings) []*RepositoryStatus {
+	var res []*RepositoryStatus
+	for _, url := range chartRepositories(deps) {
+		s := &RepositoryStatus{URL: url, Name: repos.name(url)}
+		s.IndexFile, s.Err = repos.cachedIndexFile(url, settings)
+		res = append(res, s)
+	}
+	return res
+}
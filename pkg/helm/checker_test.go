@@ -0,0 +1,211 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// recordingLogger records all messages.
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) record(level, format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, level+": "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.record("debug", format, args...)
+}
+
+func (l *recordingLogger) Infof(format string, args ...interface{}) {
+	l.record("info", format, args...)
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.record("warn", format, args...)
+}
+
+func (l *recordingLogger) Errorf(format string, args ...interface{}) {
+	l.record("error", format, args...)
+}
+
+// captureStdout returns everything written to stdout while calling fn.
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	require.NoError(t, err, "there must be no error creating a pipe")
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+	w.Close()
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err, "there must be no error reading stdout")
+	return string(data)
+}
+
+func TestCheckerCheck(t *testing.T) {
+	chartPath := copyFixtureChart(t, "chart-v2")
+	logger := &recordingLogger{}
+	checker := NewChecker(Options{
+		Settings:     newTestSettings(t),
+		Repositories: &RepositoryOptions{Offline: true},
+		Logger:       logger,
+	})
+
+	var (
+		report *Report
+		err    error
+	)
+	stdout := captureStdout(t, func() {
+		report, err = checker.Check(context.Background(), chartPath)
+	})
+	require.NoError(t, err, "there should be no error checking the chart")
+	assert.Empty(t, stdout, "nothing should be written to stdout")
+	assert.NotEmpty(t, logger.messages, "the progress should be logged")
+
+	assert.Equal(t, chartPath, report.ChartPath)
+	require.Len(t, report.Results, 2, "there should be a result for every dependency")
+	assert.Equal(t, "testdependency", report.Results[0].Name)
+	assert.Equal(t, Statuses.Outdated, report.Results[0].Status)
+	assert.Equal(t, "testdependency1", report.Results[1].Name)
+	assert.Equal(t, Statuses.Unresolvable, report.Results[1].Status)
+	assert.Equal(t, &Position{File: "Chart.yaml", Line: 8, Column: 14}, report.Results[0].Position, "the position of the version should be tracked")
+	assert.Equal(t, &Position{File: "Chart.yaml", Line: 11, Column: 14}, report.Results[1].Position, "the position of the version should be tracked")
+	require.NotNil(t, report.Results[0].LatestChart, "the metadata of the latest version should be kept")
+	assert.Equal(t, "https://testdependency.evil.corp", report.Results[0].LatestChart.Home)
+	assert.Equal(t, []string{"https://github.com/evil-corp/testdependency"}, report.Results[0].LatestChart.Sources)
+	assert.Equal(t, report.Results[:1], report.Outdated())
+	assert.Equal(t, report.Results[1:], report.Failed())
+
+	require.Len(t, report.Repositories, 1, "both dependencies use the same repository")
+	assert.Equal(t, testRepository, report.Repositories[0].URL)
+	assert.False(t, report.Repositories[0].Updated, "no index should be downloaded in offline mode")
+	assert.NoError(t, report.Repositories[0].Err)
+	assert.Equal(t, "repo-evil-corp-index.yaml", filepath.Base(report.Repositories[0].IndexFile))
+}
+
+func TestCheckerIndexCache(t *testing.T) {
+	chartPath := copyFixtureChart(t, "chart-v2")
+	options := Options{
+		Settings:     newTestSettings(t),
+		Repositories: &RepositoryOptions{Offline: true},
+		Logger:       NopLogger,
+	}
+	checker := NewChecker(options)
+
+	report, err := checker.Check(context.Background(), chartPath)
+	require.NoError(t, err, "there should be no error checking the chart")
+	indexFile := report.Repositories[0].IndexFile
+	require.Contains(t, checker.indexes.entries, indexFile, "the index should be cached by the checker")
+	idx := checker.indexes.entries[indexFile].index
+
+	_, err = checker.Check(context.Background(), chartPath)
+	require.NoError(t, err, "there should be no error checking the chart again")
+	assert.Same(t, idx, checker.indexes.entries[indexFile].index, "the index should be parsed once per checker")
+	assert.Empty(t, NewChecker(options).indexes.entries, "checkers should not share the indexes")
+}
+
+func TestCheckerCheckUnreachableRepository(t *testing.T) {
+	withShortRetryBackoff(t)
+
+	var requests int32
+	srv := newUnavailableServer(t, 100, &requests)
+	chartPath := copyFixtureChart(t, "chart-v2")
+	checker := NewChecker(Options{
+		Settings: newTestSettings(t),
+		Filter:   &Filter{DependencyNames: []string{"testdependency"}},
+		Policy:   &Policy{Repository: srv.URL},
+		Logger:   NopLogger,
+	})
+
+	report, err := checker.Check(context.Background(), chartPath)
+	require.NoError(t, err, "an unreachable repository should not fail the check")
+	require.Len(t, report.Repositories, 1)
+	assert.Equal(t, srv.URL, report.Repositories[0].URL)
+	assert.False(t, report.Repositories[0].Updated, "the repository should not be updated")
+	assert.Error(t, report.Repositories[0].Err, "the error of the repository should be reported")
+
+	require.Len(t, report.Results, 2)
+	for _, r := range report.Results {
+		assert.Equal(t, Statuses.RepoUnreachable, r.Status, "%s should be unreachable", r.Name)
+	}
+}
+
+func TestCheckerApply(t *testing.T) {
+	chartPath := copyFixtureChart(t, "chart-v2")
+	checker := NewChecker(Options{
+		Settings:     newTestSettings(t),
+		Repositories: &RepositoryOptions{Offline: true},
+		Logger:       NopLogger,
+	})
+
+	report, err := checker.Check(context.Background(), chartPath)
+	require.NoError(t, err, "there should be no error checking the chart")
+
+	plan := report.Plan(UpdateStrategies.Pin)
+	plan.IncrementChartVersion = IncTypes.Minor
+	require.Len(t, plan.Updates, 1, "only the outdated dependency should be updated")
+
+	stdout := captureStdout(t, func() {
+		err = checker.Apply(context.Background(), plan)
+	})
+	require.NoError(t, err, "there should be no error applying the plan")
+	assert.Empty(t, stdout, "nothing should be written to stdout")
+
+	c, err := loader.Load(chartPath)
+	require.NoError(t, err, "there must be no error loading the updated chart")
+	assert.Equal(t, "0.2.0", c.Metadata.Version, "the version of the chart should be incremented")
+	assert.Equal(t, "2.1.0", c.Metadata.Dependencies[0].Version, "the outdated dependency should be updated")
+	assert.Equal(t, "0.0.2", c.Metadata.Dependencies[1].Version, "the unresolvable dependency should not be changed")
+}
+
+func TestCheckerApplyCancelled(t *testing.T) {
+	chartPath := copyFixtureChart(t, "chart-v2")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := NewChecker(Options{Logger: NopLogger}).Apply(ctx, &Plan{
+		ChartPath:             chartPath,
+		Updates:               []*Result{newOutdatedResult("testdependency", "0.0.1", "2.1.0")},
+		IncrementChartVersion: IncTypes.Patch,
+	})
+	assert.Equal(t, context.Canceled, err, "a cancelled plan should not be applied")
+
+	c, err := loader.Load(chartPath)
+	require.NoError(t, err, "there must be no error loading the chart")
+	assert.Equal(t, "0.1.0", c.Metadata.Version, "the chart should not be changed")
+}
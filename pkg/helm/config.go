@@ -0,0 +1,267 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the name of the project configuration file.
+const ConfigFileName = ".helm-outdated.yaml"
+
+// ConfigError is an error in a configuration file.
+type ConfigError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+// Error implements the error interface.
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// FindConfigFile returns the path of the configuration file for the given chart or an empty string.
+// The file is looked up in the chart directory first and then in the root directory of the git repository.
+func FindConfigFile(chartPath string) (string, error) {
+	dir, err := filepath.Abs(chartPath)
+	if err != nil {
+		return "", err
+	}
+
+	if p := filepath.Join(dir, ConfigFileName); fileExists(p) {
+		return p, nil
+	}
+
+	for d := dir; ; d = filepath.Dir(d) {
+		if fileExists(filepath.Join(d, ".git")) {
+			if p := filepath.Join(d, ConfigFileName); fileExists(p) {
+				return p, nil
+			}
+			return "", nil
+		}
+		if filepath.Dir(d) == d {
+			return "", nil
+		}
+	}
+}
+
+// LoadConfigFile loads the policy declared in the given configuration file.
+//
+// The file declares the default policy and rules for single dependencies. Its JSON schema is
+// helm-outdated.schema.json in the root of this repository:
+//
+//	maxBump: minor                  # patch, minor or major
+//	prereleases: never              # never, if-current-is-prerelease or always
+//	minReleaseAge: 72h              # only propose versions published at least this long ago
+//	dependencies:
+//	  - name: redis                 # name or alias of the dependency
+//	    ignore: false               # ignore the dependency entirely
+//	    ignoreVersions:             # versions or constraints which are never proposed
+//	      - 6.0.0
+//	      - ">=7.0.0 <7.1.0"
+//	    maxBump: patch
+//	    prereleases: always
+//	    minReleaseAge: 168h
+//	    repository: https://charts.bitnami.com/bitnami  # look up versions in this repository instead
+func LoadConfigFile(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(filepath.Base(path), data)
+}
+
+func parseConfig(fileName string, data []byte) (*Policy, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %s", fileName, err)
+	}
+
+	policy := &Policy{}
+	if len(root.Content) == 0 {
+		return policy, nil
+	}
+
+	p := &configParser{fileName: fileName}
+	err := p.mapping(root.Content[0], func(key, value *yaml.Node) error {
+		switch key.Value {
+		case "dependencies":
+			return p.dependencies(value, policy)
+		case "ignore", "ignoreVersions", "repository":
+			return p.errorf(key, "%s can only be declared for single dependencies", key.Value)
+		default:
+			policy.Rule = joinNonEmpty(", ", policy.Rule, fmt.Sprintf("%s:%d", fileName, key.Line))
+			return p.policyField(key, value, policy)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+type configParser struct {
+	fileName string
+}
+
+func (p *configParser) errorf(node *yaml.Node, format string, args ...interface{}) error {
+	return &ConfigError{File: p.fileName, Line: node.Line, Message: fmt.Sprintf(format, args...)}
+}
+
+// mapping calls the function for each key and value of the mapping node.
+func (p *configParser) mapping(node *yaml.Node, fn func(key, value *yaml.Node) error) error {
+	if node.Kind != yaml.MappingNode {
+		return p.errorf(node, "expected a mapping")
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if err := fn(node.Content[i], node.Content[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *configParser) scalar(node *yaml.Node) (string, error) {
+	if node.Kind != yaml.ScalarNode {
+		return "", p.errorf(node, "expected a scalar value")
+	}
+	return node.Value, nil
+}
+
+func (p *configParser) dependencies(node *yaml.Node, policy *Policy) error {
+	if node.Kind != yaml.SequenceNode {
+		return p.errorf(node, "expected a list of dependencies")
+	}
+
+	policy.Dependencies = map[string]*Policy{}
+	for _, item := range node.Content {
+		rule := &Policy{Rule: fmt.Sprintf("%s:%d", p.fileName, item.Line)}
+		name := ""
+
+		err := p.mapping(item, func(key, value *yaml.Node) error {
+			if key.Value != "name" {
+				return p.policyField(key, value, rule)
+			}
+
+			var err error
+			name, err = p.scalar(value)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if name == "" {
+			return p.errorf(item, "dependency rule has no name")
+		}
+		if existing, ok := policy.Dependencies[name]; ok {
+			return p.errorf(item, "duplicate rule for dependency %s, already declared in %s", name, existing.Rule)
+		}
+		policy.Dependencies[name] = rule
+	}
+	return nil
+}
+
+// policyField sets the field of the policy declared by the key and value.
+func (p *configParser) policyField(key, value *yaml.Node, policy *Policy) error {
+	switch key.Value {
+	case "maxBump":
+		s, err := p.scalar(value)
+		if err != nil {
+			return err
+		}
+		if policy.MaxBump, err = ParseIncType(s); err != nil {
+			return p.errorf(value, "%s", err)
+		}
+
+	case "prereleases":
+		s, err := p.scalar(value)
+		if err != nil {
+			return err
+		}
+		if policy.Prereleases, err = ParsePrereleasePolicy(s); err != nil {
+			return p.errorf(value, "%s", err)
+		}
+
+	case "ignore":
+		s, err := p.scalar(value)
+		if err != nil {
+			return err
+		}
+		if policy.Ignore, err = strconv.ParseBool(s); err != nil {
+			return p.errorf(value, "invalid value %q for ignore, must be true or false", s)
+		}
+
+	case "ignoreVersions":
+		if value.Kind != yaml.SequenceNode {
+			return p.errorf(value, "expected a list of versions or constraints")
+		}
+		for _, item := range value.Content {
+			s, err := p.scalar(item)
+			if err != nil {
+				return err
+			}
+			c, err := semver.NewConstraint(s)
+			if err != nil {
+				return p.errorf(item, "invalid version or constraint %q: %s", s, err)
+			}
+			policy.IgnoreVersions = append(policy.IgnoreVersions, c)
+		}
+
+	case "minReleaseAge":
+		s, err := p.scalar(value)
+		if err != nil {
+			return err
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return p.errorf(value, "invalid duration %q for minReleaseAge, e.g. 72h", s)
+		}
+		policy.MinReleaseAge = d
+
+	case "repository":
+		s, err := p.scalar(value)
+		if err != nil {
+			return err
+		}
+		if s == "" {
+			return p.errorf(value, "repository must not be empty")
+		}
+		policy.Repository = s
+
+	default:
+		return p.errorf(key, "unknown field %q", key.Value)
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,184 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+const testConfig = `# Project configuration
+maxBump: minor
+prereleases: never
+dependencies:
+  - name: testdependency
+    ignoreVersions:
+      - 2.1.0
+      - ">=1.3.0 <1.5.0"
+    maxBump: major
+    minReleaseAge: 72h
+  - name: testdependency1
+    ignore: true
+  - name: aliased
+    prereleases: always
+    repository: https://charts.evil.corp
+`
+
+func TestParseConfig(t *testing.T) {
+	policy, err := parseConfig(ConfigFileName, []byte(testConfig))
+	require.NoError(t, err, "there should be no error parsing the config")
+
+	assert.Equal(t, IncTypes.Minor, policy.MaxBump)
+	assert.Equal(t, PrereleasePolicies.Never, policy.Prereleases)
+	assert.Equal(t, ".helm-outdated.yaml:2, .helm-outdated.yaml:3", policy.Rule, "the rule should point at the top-level settings")
+	require.Len(t, policy.Dependencies, 3, "there should be a rule for each dependency")
+
+	p := policy.forDependency(&chart.Dependency{Name: "testdependency"})
+	assert.Equal(t, IncTypes.Major, p.MaxBump, "the max bump of the rule should take precedence")
+	assert.Equal(t, 72*time.Hour, p.MinReleaseAge)
+	assert.Equal(t, ".helm-outdated.yaml:2, .helm-outdated.yaml:3, .helm-outdated.yaml:5", p.Rule, "the rule should point at its declarations")
+	assert.True(t, p.isIgnored(semver.MustParse("2.1.0")), "the exact version should be ignored")
+	assert.True(t, p.isIgnored(semver.MustParse("1.4.0")), "versions in the range should be ignored")
+	assert.False(t, p.isIgnored(semver.MustParse("2.0.0")), "other versions should not be ignored")
+
+	p = policy.forDependency(&chart.Dependency{Name: "testdependency1"})
+	assert.True(t, p.Ignore, "the dependency should be ignored")
+
+	p = policy.forDependency(&chart.Dependency{Name: "other"})
+	assert.Equal(t, ".helm-outdated.yaml:2, .helm-outdated.yaml:3", p.Rule, "the top-level settings should be listed for dependencies without a rule")
+
+	p = policy.forDependency(&chart.Dependency{Name: "testdependency", Alias: "aliased"})
+	assert.Equal(t, PrereleasePolicies.Always, p.Prereleases)
+	assert.Equal(t, "https://charts.evil.corp", p.Repository)
+	assert.Equal(t, ".helm-outdated.yaml:2, .helm-outdated.yaml:3, .helm-outdated.yaml:5, .helm-outdated.yaml:13", p.Rule, "all rules should be listed")
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name,
+		config,
+		expectedError string
+	}{
+		{"unknown field", "maxBump: minor\nmaxbumps: major\n", `.helm-outdated.yaml:2: unknown field "maxbumps"`},
+		{"invalid max bump", "dependencies:\n  - name: redis\n    maxBump: huge\n", ".helm-outdated.yaml:3: invalid version increment \"huge\""},
+		{"invalid constraint", "dependencies:\n  - name: redis\n    ignoreVersions:\n      - 1.x.y\n", `.helm-outdated.yaml:4: invalid version or constraint "1.x.y"`},
+		{"invalid ignore", "dependencies:\n  - name: redis\n    ignore: sometimes\n", `.helm-outdated.yaml:3: invalid value "sometimes" for ignore`},
+		{"invalid min release age", "minReleaseAge: 3 days\n", `.helm-outdated.yaml:1: invalid duration "3 days" for minReleaseAge`},
+		{"missing name", "dependencies:\n  - maxBump: patch\n", ".helm-outdated.yaml:2: dependency rule has no name"},
+		{"duplicate name", "dependencies:\n  - name: redis\n  - name: redis\n", ".helm-outdated.yaml:3: duplicate rule for dependency redis, already declared in .helm-outdated.yaml:2"},
+		{"top level ignore", "ignore: true\n", ".helm-outdated.yaml:1: ignore can only be declared for single dependencies"},
+		{"no list", "dependencies:\n  redis: {}\n", ".helm-outdated.yaml:2: expected a list of dependencies"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig(ConfigFileName, []byte(tt.config))
+			require.Error(t, err, "the config should be rejected")
+			assert.Contains(t, err.Error(), tt.expectedError)
+		})
+	}
+}
+
+func TestParseConfigEmpty(t *testing.T) {
+	policy, err := parseConfig(ConfigFileName, []byte("# nothing configured\n"))
+	require.NoError(t, err, "there should be no error parsing an empty config")
+	assert.Equal(t, &Policy{}, policy)
+}
+
+func TestConfigSchema(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("..", "..", "helm-outdated.schema.json"))
+	require.NoError(t, err, "there must be no error reading the schema")
+
+	var schema struct {
+		Properties  map[string]interface{} `json:"properties"`
+		Definitions struct {
+			Dependency struct {
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"dependency"`
+		} `json:"definitions"`
+	}
+	require.NoError(t, json.Unmarshal(data, &schema), "the schema should be valid JSON")
+	require.NotEmpty(t, schema.Properties, "the schema should declare the top-level fields")
+	require.NotEmpty(t, schema.Definitions.Dependency.Properties, "the schema should declare the fields of dependency rules")
+
+	for key := range schema.Properties {
+		_, err := parseConfig(ConfigFileName, []byte(key+": x\n"))
+		if err != nil {
+			assert.NotContains(t, err.Error(), "unknown field", "the top-level field %s of the schema should be known", key)
+		}
+	}
+	for key := range schema.Definitions.Dependency.Properties {
+		_, err := parseConfig(ConfigFileName, []byte("dependencies:\n  - name: redis\n    "+key+": x\n"))
+		if err != nil {
+			assert.NotContains(t, err.Error(), "unknown field", "the dependency field %s of the schema should be known", key)
+		}
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	root := t.TempDir()
+	chartPath := filepath.Join(root, "charts", "mychart")
+	require.NoError(t, os.MkdirAll(chartPath, 0755), "there must be no error creating the chart directory")
+
+	p, err := FindConfigFile(chartPath)
+	require.NoError(t, err, "there should be no error looking up the config file")
+	assert.Empty(t, p, "there should be no config file")
+
+	require.NoError(t, os.Mkdir(filepath.Join(root, ".git"), 0755), "there must be no error creating the git directory")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, ConfigFileName), []byte(testConfig), 0644), "there must be no error writing the config file")
+
+	p, err = FindConfigFile(chartPath)
+	require.NoError(t, err, "there should be no error looking up the config file")
+	assert.Equal(t, filepath.Join(root, ConfigFileName), p, "the config file at the root of the git repository should be found")
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(chartPath, ConfigFileName), []byte(testConfig), 0644), "there must be no error writing the config file")
+
+	p, err = FindConfigFile(chartPath)
+	require.NoError(t, err, "there should be no error looking up the config file")
+	assert.Equal(t, filepath.Join(chartPath, ConfigFileName), p, "the config file next to the chart should take precedence")
+}
+
+func TestFindLatestVersionOfDependencyWithIgnoredVersions(t *testing.T) {
+	dep := &chart.Dependency{Name: "testdependency", Version: "1.2.0", Repository: testRepository}
+	constraint, err := semver.NewConstraint(dep.Version)
+	require.NoError(t, err, "there must be no error parsing the constraint")
+
+	policy := (&Policy{IgnoreVersions: []*semver.Constraints{mustConstraint(t, ">=2.1.0")}}).forDependency(dep)
+	latestSatisfyingVersion, latestVersion, _, err := findLatestVersionOfDependency(context.Background(), dep, mustLoadChartVersions(t, dep, newTestSettings(t)), constraint, policy)
+	require.NoError(t, err, "there should be no error finding the latest version")
+	assert.Equal(t, "1.2.0", latestSatisfyingVersion.String(), "ignored versions should not affect the current version")
+	assert.Equal(t, "2.0.0", latestVersion.String(), "ignored versions should not be proposed")
+}
+
+func mustConstraint(t *testing.T, c string) *semver.Constraints {
+	constraint, err := semver.NewConstraint(c)
+	require.NoError(t, err, "there must be no error parsing the constraint %s", c)
+	return constraint
+}
@@ -20,22 +20,20 @@
 package helm
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"path/filepath"
-	"sort"
 	"strings"
-	"sync"
+	"time"
 
-	"github.com/Masterminds/semver"
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
 
-    log "github.com/sirupsen/logrus"
-
-	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/repo"
 	"helm.sh/helm/v3/pkg/chart"
     "helm.sh/helm/v3/pkg/chart/loader"
     "helm.sh/helm/v3/pkg/cli"
-	"helm.sh/helm/v3/pkg/helmpath"
 )
 
 const (
@@ -45,103 +43,29 @@ const (
 )
 
 // ListOutdatedDependencies returns a list of outdated dependencies of the given chart.
+//
+// Deprecated: Use Checker.Check, which also reports the dependencies which could not be checked.
 func ListOutdatedDependencies(chartPath string, settings *cli.EnvSettings, dependencyFilter *Filter) ([]*Result, error) {
-	chartDeps, err := loadDependencies(chartPath, dependencyFilter)
+	report, err := NewChecker(Options{Settings: settings, Filter: dependencyFilter}).Check(context.Background(), chartPath)
 	if err != nil {
-// 		if err == chartutil.ErrRequirementsNotFound {
-// 			fmt.Printf("Chart %v has no requirements.\n", chartPath)
-// 			return nil, nil
-// 		}
-		return nil, err
-	}
-
-    // Update local cached repositories
-	if err = parallelRepoUpdate(chartDeps, settings); err != nil {
 		return nil, err
 	}
-
-	var res []*Result
-	for _, dep := range chartDeps {
-		depVersion, err := semver.NewVersion(dep.Version)
-		if err != nil {
-			fmt.Printf("Error creating semVersion for dependency %s: %s", dep.Name, err.Error())
-			continue
-		}
-
-		latestVersion, err := findLatestVersionOfDependency(dep, settings)
-		if err != nil {
-			fmt.Printf("Error getting latest version of %s: %s\n", dep.Name, err.Error())
-			continue
-		}
-
-		if depVersion.LessThan(latestVersion) {
-			currentVersion, err := semver.NewVersion(dep.Version)
-			if err != nil {
-				continue
-			}
-
-			res = append(res, &Result{
-				Dependency:     dep,
-				CurrentVersion: currentVersion,
-				LatestVersion:  latestVersion,
-			})
-		}
-	}
-
-	return sortResultsAlphabetically(res), nil
+	return report.Outdated(), nil
 }
 
-// UpdateDependencies updates the dependencies of the given chart.
+// UpdateDependencies updates the dependencies of the given chart to their latest version.
+// The indent is ignored as comments and formatting of the file are preserved.
+//
+// Deprecated: Use Checker.Apply .
 func UpdateDependencies(chartPath string, reqsToUpdate []*Result, indent int) error {
-    log.Info("Updating outdated dependencies of chart '" + chartPath +"''")
-	c, err := loader.Load(chartPath)
-	if err != nil {
-		return err
-	}
-
-	reqs := c.Metadata.Dependencies
-
-	for _, newDep := range reqsToUpdate {
-		for _, oldDep := range reqs {
-			if newDep.Name == oldDep.Name && newDep.Repository == newDep.Repository {
-			    log.Debug("Updating dependency " + oldDep.Name + " from " + oldDep.Version + " in " + newDep.LatestVersion.String())
-				oldDep.Version = newDep.LatestVersion.String()
-			}
-		}
-	}
-
-	reqs = sortRequirementsAlphabetically(reqs)
-	if err := writeRequirements(chartPath, reqs, indent); err != nil {
-		return err
-	}
-
-    return nil;
+	return NewChecker(Options{}).Apply(context.Background(), &Plan{ChartPath: chartPath, Updates: reqsToUpdate, Strategy: UpdateStrategies.Pin})
 }
 
 // IncrementChart version increments the patch version of the Chart.
+//
+// Deprecated: Use Checker.Apply .
 func IncrementChartVersion(chartPath string, incType IncType) error {
-	c, err := loader.Load(chartPath)
-	if err != nil {
-		return err
-	}
-
-	chartVersion, err := getChartVersion(c)
-	if err != nil {
-		return err
-	}
-
-	var newVersion semver.Version
-	switch incType {
-	case IncTypes.Major:
-		newVersion = chartVersion.IncMajor()
-	case IncTypes.Minor:
-		newVersion = chartVersion.IncMinor()
-	default:
-		newVersion = chartVersion.IncPatch()
-	}
-
-	c.Metadata.Version = newVersion.String()
-	return writeChartMetadata(chartPath, c.Metadata)
+	return NewChecker(Options{}).Apply(context.Background(), &Plan{ChartPath: chartPath, IncrementChartVersion: incType})
 }
 
 // GetChartName returns the name of the chart in the given path or an error.
@@ -154,11 +78,11 @@ func GetChartName(chartPath string) (string, error) {
 	return c.Metadata.Name, nil
 }
 
-// loadDependencies loads the dependencies of the given chart.
-func loadDependencies(chartPath string, f *Filter) ([]*chart.Dependency, error) {
+// loadDependencies loads the given chart and its dependencies.
+func loadDependencies(chartPath string, repos repositories, f *Filter) (*chart.Chart, []*chart.Dependency, error) {
 	c, err := loader.Load(chartPath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	reqs := c.Metadata.Dependencies
@@ -171,74 +95,165 @@ func loadDependencies(chartPath string, f *Filter) ([]*chart.Dependency, error)
 		deps = append(deps, d)
 	}
 
-	reqs = f.FilterDependencies(deps)
-	return reqs, nil
+	reqs = f.filterDependencies(deps, repos)
+	return c, reqs, nil
 }
 
-// findLatestVersionOfDependency returns the latest version of the given dependency in the repository.
-func findLatestVersionOfDependency(dep *chart.Dependency, settings *cli.EnvSettings) (*semver.Version, error) {
-	// Handle local dependencies.
-	if strings.Contains(dep.Repository, filePrefix) {
-		c, err := loader.Load(strings.TrimPrefix(dep.Repository, filePrefix))
-		if err != nil {
-			return nil, err
-		}
-		return semver.NewVersion(c.Metadata.Version)
-	}
-
-	// Read the index file for the repository to get chart information and return chart URL
-	fmt.Printf("Loading cache index file for repository %s from cache dir %s\n", dep.Repository, settings.RepositoryCache)
-	repoIndex, err := repo.LoadIndexFile(filepath.Join(settings.RepositoryCache, helmpath.CacheIndexFile(normalizeRepoName(dep.Repository))))
+// loadDependencyPositions returns the positions of the versions of the dependencies of the chart by dependencyKey.
+func loadDependencyPositions(chartPath string, c *chart.Chart) (map[string]*Position, error) {
+	fileName := dependenciesFileName(c)
+	data, err := ioutil.ReadFile(filepath.Join(chartPath, fileName))
 	if err != nil {
 		return nil, err
 	}
 
-	// With no version given the highest one is returned.
-	cv, err := repoIndex.Get(dep.Name, "")
+	doc, err := newYAMLDocument(data)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "failed to parse %s", fileName)
 	}
 
-	return semver.NewVersion(cv.Version)
+	res := map[string]*Position{}
+	for _, dep := range c.Metadata.Dependencies {
+		line, column, err := doc.DependencyPosition(dep.Name, dep.Alias)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find dependency %s in %s", dep.Name, fileName)
+		}
+		res[dependencyKey(dep.Name, dep.Alias)] = &Position{File: fileName, Line: line, Column: column}
+	}
+	return res, nil
 }
 
-func sortRequirementsAlphabetically(reqs []*chart.Dependency) []*chart.Dependency {
-	sort.Slice(reqs, func(i, j int) bool {
-		return reqs[i].Name < reqs[j].Name
-	})
-	return reqs
+// dependencyKey identifies a dependency of a chart by its name and alias.
+func dependencyKey(name, alias string) string {
+	return name + "/" + alias
 }
 
-func parallelRepoUpdate(chartDeps []*chart.Dependency, settings *cli.EnvSettings) error {
-	var repos []string
-	for _, dep := range chartDeps {
-		if !stringSliceContains(repos, dep.Repository) && !strings.Contains(dep.Repository, filePrefix) {
-			repos = append(repos, dep.Repository)
+// findLatestVersionOfDependency returns the latest of the given versions of the dependency satisfying the constraint
+// and the latest version allowed by the policy. The first one is nil if no version satisfies the constraint.
+// If a newer version is only excluded because it was released too recently, it is returned as cooldown.
+// The policy must be the one for the dependency.
+func findLatestVersionOfDependency(ctx context.Context, dep *chart.Dependency, chartVersions repo.ChartVersions, constraint *semver.Constraints, policy *Policy) (*semver.Version, *semver.Version, *Cooldown, error) {
+	allowsPrerelease := policy.allowsPrerelease(dep.Version)
+
+	var (
+		versions []*semver.Version
+		created  = map[*semver.Version]time.Time{}
+	)
+	for _, cv := range chartVersions {
+		v, err := semver.NewVersion(cv.Version)
+		if err != nil {
+			loggerFrom(ctx).Debugf("Ignoring invalid version %s of %s: %s", cv.Version, dep.Name, err)
+			continue
 		}
+
+		if v.Prerelease() != "" && !allowsPrerelease {
+			continue
+		}
+		versions = append(versions, v)
+		created[v] = cv.Created
+	}
+
+	if len(versions) == 0 {
+		return nil, nil, nil, repo.ErrNoChartVersion
 	}
 
-	var wg sync.WaitGroup
-	for _, c := range repos {
-		tmpRepo := &repo.Entry{
-			Name: normalizeRepoName(c),
-			URL:  c,
+	var latestSatisfyingVersion *semver.Version
+	for _, v := range versions {
+		if constraint.Check(v) && (latestSatisfyingVersion == nil || v.GreaterThan(latestSatisfyingVersion)) {
+			latestSatisfyingVersion = v
 		}
+	}
 
-		r, err := repo.NewChartRepository(tmpRepo, getter.All(settings))
-		if err != nil {
-			return err
+	// The size of an update is determined relative to the current version or, if no version satisfies the
+	// constraint, to the version declared in the constraint.
+	currentVersion := getCurrentVersion(dep, latestSatisfyingVersion)
+	if currentVersion == nil {
+		currentVersion = getConstraintVersion(dep.Version)
+	}
+
+	var (
+		latestVersion *semver.Version
+		cooldown      *Cooldown
+	)
+	for _, v := range versions {
+		if !policy.allows(currentVersion, v) || policy.isIgnored(v) {
+			continue
 		}
 
-		wg.Add(1)
-		go func(r *repo.ChartRepository) {
-			if idx,err := r.DownloadIndexFile(); err != nil {
-				fmt.Printf("unable to get an update from the %q chart repository (%s):\n\t%s\n", r.Config.Name, r.Config.URL, err)
-			} else {
-				fmt.Printf("successfully got an update from the %q chart repository, updated %s\n", r.Config.URL, idx)
+		// The version in use is never excluded, even if it was released recently.
+		if until, ok := policy.cooldownUntil(created[v]); ok && (currentVersion == nil || !v.Equal(currentVersion)) {
+			if cooldown == nil || v.GreaterThan(cooldown.Version) {
+				cooldown = &Cooldown{Version: v, Until: until}
 			}
-			wg.Done()
-		}(r)
+			continue
+		}
+
+		if latestVersion == nil || v.GreaterThan(latestVersion) {
+			latestVersion = v
+		}
+	}
+
+	if latestVersion == nil {
+		if cooldown != nil {
+			return nil, nil, nil, fmt.Errorf("no version of %s allowed by the policy, %s", dep.Name, cooldown.String())
+		}
+		return nil, nil, nil, fmt.Errorf("no version of %s allowed by the policy", dep.Name)
+	}
+
+	// Only versions newer than the proposed one are worth reporting.
+	if cooldown != nil && !cooldown.Version.GreaterThan(latestVersion) {
+		cooldown = nil
+	}
+
+	return latestSatisfyingVersion, latestVersion, cooldown, nil
+}
+
+// loadChartVersions returns all versions of the given dependency available in the repository using the version
+// source for its scheme. In offline mode, ErrNoCachedIndex is returned if the versions are not cached.
+func loadChartVersions(ctx context.Context, dep *chart.Dependency, repos repositories, settings *cli.EnvSettings, repoOptions *RepositoryOptions) (repo.ChartVersions, error) {
+	req := newSourceRequest(ctx, dep.Repository, repos, settings, repoOptions)
+	return versionSourceFor(dep.Repository).ChartVersions(ctx, req, dep.Name)
+}
+
+// parallelRepoUpdate updates the indexes of the repositories of the dependencies and returns their status.
+func parallelRepoUpdate(ctx context.Context, chartDeps []*chart.Dependency, configured repositories, repoOptions *RepositoryOptions, settings *cli.EnvSettings) []*RepositoryStatus {
+	var statuses []*RepositoryStatus
+	for _, c := range chartRepositories(chartDeps) {
+		statuses = append(statuses, &RepositoryStatus{URL: c, Name: configured.name(c)})
+	}
+
+	logger := loggerFrom(ctx)
+	forEach(len(statuses), repoOptions.concurrency(), func(i int) {
+		s := statuses[i]
+		req := newSourceRequest(ctx, s.URL, configured, settings, repoOptions)
+		s.IndexFile, s.Err = versionSourceFor(s.URL).(IndexUpdater).Update(ctx, req)
+		if s.Err != nil {
+			s.IndexFile = ""
+			logger.Warnf("Unable to get an update from the chart repository %s: %s", s.URL, s.Err)
+			return
+		}
+		s.Updated = true
+		logger.Infof("Successfully got an update from the chart repository %s", s.URL)
+	})
+	return statuses
+}
+
+// downloadWithContext calls download, which cannot be cancelled, and returns early once the context is done.
+func downloadWithContext(ctx context.Context, download func() (string, error)) (string, error) {
+	type result struct {
+		path string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		path, err := download()
+		done <- result{path, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case r := <-done:
+		return r.path, r.err
 	}
-	wg.Wait()
-	return nil
 }
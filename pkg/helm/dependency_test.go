@@ -20,57 +20,295 @@
 package helm
 
 import (
-	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
-	"helm.sh/helm/v3/pkg/chartutil"
+	"context"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/repo"
 )
 
-func newRequirements() *chartutil.Requirements {
-	return &chartutil.Requirements{
-		Dependencies: []*chartutil.Dependency{
-			{
-				Name:       "testdependency",
-				Version:    "v0.0.1",
-				Repository: "https://repo.evil.corp",
-			},
-			{
-				Name:       "testdepdendency1",
-				Version:    "v0.0.2",
-				Repository: "https://repo.evil.corp",
-			},
-		},
+const testRepository = "https://repo.evil.corp"
+
+// The deprecated functions keep their original signatures for existing callers of the library.
+var (
+	_ func(string, *cli.EnvSettings, *Filter) ([]*Result, error) = ListOutdatedDependencies
+	_ func(string, []*Result, int) error                         = UpdateDependencies
+	_ func(string, IncType) error                                = IncrementChartVersion
+)
+
+// copyFixtureChart copies the chart from the fixtures folder to a temporary directory and returns its path.
+func copyFixtureChart(t *testing.T, name string) string {
+	dir, err := os.Getwd()
+	require.NoError(t, err, "there must be no error getting the current path")
+
+	src := path.Join(dir, "fixtures", name)
+	dst := path.Join(t.TempDir(), name)
+	require.NoError(t, os.MkdirAll(dst, 0755), "there must be no error creating the chart directory")
+
+	files, err := ioutil.ReadDir(src)
+	require.NoError(t, err, "there must be no error reading the fixture chart")
+	for _, f := range files {
+		data, err := ioutil.ReadFile(filepath.Join(src, f.Name()))
+		require.NoError(t, err, "there must be no error reading %s", f.Name())
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dst, f.Name()), data, 0644), "there must be no error writing %s", f.Name())
 	}
+
+	return dst
 }
 
-func ensureEmptyFileExists(pathParts ...string) error {
-	filepath := path.Join(pathParts...)
-	if f, err := os.Create(filepath); err != nil {
-		if os.IsExist(err) {
-			return f.Truncate(0)
-		}
-		return err
-	}
-	return nil
+// newTestSettings returns settings with a repository cache containing the index of the test repository.
+func newTestSettings(t *testing.T) *cli.EnvSettings {
+	settings := cli.New()
+	settings.RepositoryCache = t.TempDir()
+
+	data, err := ioutil.ReadFile(filepath.Join("fixtures", "repository", "index.yaml"))
+	require.NoError(t, err, "there must be no error reading the repository index")
+	require.NoError(t,
+		ioutil.WriteFile(filepath.Join(settings.RepositoryCache, helmpath.CacheIndexFile(normalizeRepoName(testRepository))), data, 0644),
+		"there must be no error writing the cached repository index",
+	)
+	return settings
 }
 
-func TestWriteRequirements(t *testing.T) {
-	dir, err := os.Getwd()
-	require.NoError(t, err, "there must be no error getting the current path")
-	chartPath := path.Join(dir, "fixtures")
-	require.NoError(t, ensureEmptyFileExists(chartPath, requirementsName), "there must be no error creating the requirements.yaml")
+func mustLoadChartVersions(t *testing.T, dep *chart.Dependency, settings *cli.EnvSettings) repo.ChartVersions {
+	chartVersions, err := loadChartVersions(context.Background(), dep, nil, settings, &RepositoryOptions{})
+	require.NoError(t, err, "there must be no error loading the versions of %s", dep.Name)
+	return chartVersions
+}
 
-	err = writeRequirements(chartPath, newRequirements(), 4)
-	assert.NoError(t, err, "there should be no error writing the chart requirements")
+func newOutdatedResult(name, currentVersion, latestVersion string) *Result {
+	return &Result{
+		Dependency: &chart.Dependency{
+			Name:       name,
+			Version:    currentVersion,
+			Repository: "https://repo.evil.corp",
+		},
+		CurrentVersion: semver.MustParse(currentVersion),
+		LatestVersion:  semver.MustParse(latestVersion),
+	}
 }
 
 func TestIncrementChartVersion(t *testing.T) {
-	dir, err := os.Getwd()
-	require.NoError(t, err, "there must be no error getting the current path")
-	chartPath := path.Join(dir, "fixtures")
+	chartPath := copyFixtureChart(t, "chart-v2")
 
-	err = IncrementChartVersion(chartPath, IncTypes.Patch)
+	err := IncrementChartVersion(chartPath, IncTypes.Patch)
 	assert.NoError(t, err, "there should be no error incrementing the chart version and writing the new Chart.yaml")
+
+	c, err := loader.Load(chartPath)
+	require.NoError(t, err, "there must be no error loading the updated chart")
+	assert.Equal(t, "0.1.1", c.Metadata.Version, "the patch version of the chart should have been incremented")
+	assert.Len(t, c.Metadata.Dependencies, 2, "the dependencies of the chart should have been kept")
+}
+
+func TestUpdateDependencies(t *testing.T) {
+	tests := []struct {
+		chart,
+		expectedFile,
+		unexpectedFile string
+	}{
+		{
+			chart:          "chart-v1",
+			expectedFile:   requirementsName,
+			unexpectedFile: "",
+		},
+		{
+			chart:          "chart-v2",
+			expectedFile:   chartMetadataName,
+			unexpectedFile: requirementsName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.chart, func(t *testing.T) {
+			chartPath := copyFixtureChart(t, tt.chart)
+			before, err := ioutil.ReadFile(filepath.Join(chartPath, tt.expectedFile))
+			require.NoError(t, err, "there must be no error reading %s", tt.expectedFile)
+
+			err = UpdateDependencies(chartPath, []*Result{newOutdatedResult("testdependency", "0.0.1", "0.1.0")}, 4)
+			require.NoError(t, err, "there should be no error updating the dependencies")
+
+			after, err := ioutil.ReadFile(filepath.Join(chartPath, tt.expectedFile))
+			require.NoError(t, err, "there must be no error reading %s", tt.expectedFile)
+			assert.NotEqual(t, string(before), string(after), "the dependencies should have been written to %s", tt.expectedFile)
+
+			if tt.unexpectedFile != "" {
+				_, err := os.Stat(filepath.Join(chartPath, tt.unexpectedFile))
+				assert.True(t, os.IsNotExist(err), "%s should not have been created", tt.unexpectedFile)
+			}
+
+			c, err := loader.Load(chartPath)
+			require.NoError(t, err, "there must be no error loading the updated chart")
+			require.Len(t, c.Metadata.Dependencies, 2, "the chart should still have all dependencies")
+			for _, d := range c.Metadata.Dependencies {
+				switch d.Name {
+				case "testdependency":
+					assert.Equal(t, "0.1.0", d.Version, "the outdated dependency should have been updated")
+				case "testdependency1":
+					assert.Equal(t, "0.0.2", d.Version, "the up-to-date dependency should not have been changed")
+				}
+			}
+			assert.Equal(t, "0.1.0", c.Metadata.Version, "the chart version should not have been changed")
+		})
+	}
+}
+
+func TestFindLatestVersionOfDependency(t *testing.T) {
+	tests := []struct {
+		version,
+		expectedLatestSatisfyingVersion string
+		expectedCurrentVersion string
+		expectedOutdated,
+		expectedNeedsWidening bool
+	}{
+		{
+			version:                         "2.1.0",
+			expectedLatestSatisfyingVersion: "2.1.0",
+			expectedCurrentVersion:          "2.1.0",
+		},
+		{
+			version:                         "1.2.0",
+			expectedLatestSatisfyingVersion: "1.2.0",
+			expectedCurrentVersion:          "1.2.0",
+			expectedOutdated:                true,
+			expectedNeedsWidening:           true,
+		},
+		{
+			version:                         "~1.2.0",
+			expectedLatestSatisfyingVersion: "1.2.5",
+			expectedCurrentVersion:          "1.2.5",
+			expectedOutdated:                true,
+			expectedNeedsWidening:           true,
+		},
+		{
+			version:                         "^2.0",
+			expectedLatestSatisfyingVersion: "2.1.0",
+			expectedCurrentVersion:          "2.1.0",
+		},
+		{
+			version:                         ">=1.0.0 <3.0.0",
+			expectedLatestSatisfyingVersion: "2.1.0",
+			expectedCurrentVersion:          "2.1.0",
+		},
+		{
+			version:                         "1.x || 2.0.x",
+			expectedLatestSatisfyingVersion: "2.0.0",
+			expectedCurrentVersion:          "2.0.0",
+			expectedOutdated:                true,
+			expectedNeedsWidening:           true,
+		},
+		{
+			version:               "^0.1.0",
+			expectedOutdated:      true,
+			expectedNeedsWidening: true,
+		},
+	}
+
+	settings := newTestSettings(t)
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			dep := &chart.Dependency{Name: "testdependency", Version: tt.version, Repository: testRepository}
+			constraint, err := semver.NewConstraint(dep.Version)
+			require.NoError(t, err, "there must be no error parsing the constraint")
+
+			latestSatisfyingVersion, latestVersion, _, err := findLatestVersionOfDependency(context.Background(), dep, mustLoadChartVersions(t, dep, settings), constraint, nil)
+			require.NoError(t, err, "there should be no error finding the latest version")
+			assert.Equal(t, "2.1.0", latestVersion.String(), "pre-releases should not be considered as latest version")
+			if tt.expectedLatestSatisfyingVersion == "" {
+				assert.Nil(t, latestSatisfyingVersion, "no version should satisfy the constraint")
+			} else {
+				assert.Equal(t, tt.expectedLatestSatisfyingVersion, latestSatisfyingVersion.String())
+			}
+
+			r := newResult(dep, constraint, latestSatisfyingVersion, latestVersion)
+			if tt.expectedCurrentVersion == "" {
+				assert.Nil(t, r.CurrentVersion, "there should be no current version")
+			} else {
+				assert.Equal(t, tt.expectedCurrentVersion, r.CurrentVersion.String())
+			}
+			assert.Equal(t, tt.expectedOutdated, r.IsOutdated(), "outdated")
+			assert.Equal(t, tt.expectedNeedsWidening, r.NeedsWidening, "needs widening")
+		})
+	}
+}
+
+func TestFindLatestVersionOfDependencyWithMaxBump(t *testing.T) {
+	tests := []struct {
+		version               string
+		maxBump               IncType
+		expectedLatestVersion string
+	}{
+		{"1.2.0", IncTypes.Patch, "1.2.5"},
+		{"1.2.0", IncTypes.Minor, "1.4.0"},
+		{"1.2.0", IncTypes.Major, "2.1.0"},
+		{"1.2.0", "", "2.1.0"},
+		{"2.0.0", IncTypes.Patch, "2.0.0"},
+		{"~1.2.0", IncTypes.Patch, "1.2.5"},
+		{"~1.2.0", IncTypes.Minor, "1.4.0"},
+		// No version satisfies the constraint, so the change is relative to the declared version.
+		{"~1.1.0", IncTypes.Minor, "1.4.0"},
+	}
+
+	settings := newTestSettings(t)
+	for _, tt := range tests {
+		t.Run(tt.version+"-"+string(tt.maxBump), func(t *testing.T) {
+			dep := &chart.Dependency{Name: "testdependency", Version: tt.version, Repository: testRepository}
+			constraint, err := semver.NewConstraint(dep.Version)
+			require.NoError(t, err, "there must be no error parsing the constraint")
+
+			_, latestVersion, _, err := findLatestVersionOfDependency(context.Background(), dep, mustLoadChartVersions(t, dep, settings), constraint, &Policy{MaxBump: tt.maxBump})
+			require.NoError(t, err, "there should be no error finding the latest version")
+			assert.Equal(t, tt.expectedLatestVersion, latestVersion.String())
+		})
+	}
+}
+
+func TestFindLatestVersionOfDependencyNotAllowedByPolicy(t *testing.T) {
+	dep := &chart.Dependency{Name: "testdependency", Version: "~1.1.0", Repository: testRepository}
+	constraint, err := semver.NewConstraint(dep.Version)
+	require.NoError(t, err, "there must be no error parsing the constraint")
+
+	_, _, _, err = findLatestVersionOfDependency(context.Background(), dep, mustLoadChartVersions(t, dep, newTestSettings(t)), constraint, &Policy{MaxBump: IncTypes.Patch})
+	assert.Error(t, err, "there should be an error if no version is allowed by the policy")
+}
+
+func TestLoadDependencyPositions(t *testing.T) {
+	testCases := []struct {
+		chart    string
+		expected map[string]*Position
+	}{
+		{
+			chart: "chart-v1",
+			expected: map[string]*Position{
+				"testdependency/":  {File: "requirements.yaml", Line: 4, Column: 14},
+				"testdependency1/": {File: "requirements.yaml", Line: 7, Column: 14},
+			},
+		},
+		{
+			chart: "chart-v2",
+			expected: map[string]*Position{
+				"testdependency/":  {File: "Chart.yaml", Line: 8, Column: 14},
+				"testdependency1/": {File: "Chart.yaml", Line: 11, Column: 14},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		chartPath := filepath.Join("fixtures", tc.chart)
+		c, err := loader.Load(chartPath)
+		require.NoError(t, err, "there must be no error loading the chart")
+
+		positions, err := loadDependencyPositions(chartPath, c)
+		require.NoError(t, err, "there should be no error finding the dependencies of %s", tc.chart)
+		assert.Equal(t, tc.expected, positions, "wrong positions of the dependencies of %s", tc.chart)
+	}
 }
@@ -0,0 +1,152 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// deprecatedRepositories are repositories which are no longer maintained.
+var deprecatedRepositories = []string{
+	"https://kubernetes-charts.storage.googleapis.com",
+	"https://kubernetes-charts-incubator.storage.googleapis.com",
+}
+
+// Deprecation describes why a dependency is deprecated.
+type Deprecation struct {
+	// Reason is a short description like "chart is deprecated".
+	Reason string
+	// Replacement is the URL of another configured repository providing the chart without deprecation or empty.
+	Replacement string
+}
+
+// String returns the reason and the replacement if any.
+func (d *Deprecation) String() string {
+	if d.Replacement == "" {
+		return d.Reason
+	}
+	return fmt.Sprintf("%s, use %s", d.Reason, d.Replacement)
+}
+
+// findDeprecation checks whether the dependency is deprecated and returns the reason or nil.
+// A chart is deprecated if its latest version is marked as deprecated in the repository index.
+// The versions and the current version might be nil if they cannot be determined.
+// A replacement is looked up in the configured repositories.
+func findDeprecation(ctx context.Context, dep *chart.Dependency, chartVersions repo.ChartVersions, currentVersion *semver.Version, repos repositories, settings *cli.EnvSettings) *Deprecation {
+	var reason string
+	switch {
+	case isDeprecatedRepository(dep.Repository):
+		reason = "repository is deprecated"
+	case isChartDeprecated(chartVersions):
+		reason = "chart is deprecated"
+	case currentVersion != nil && isVersionDeprecated(chartVersions, currentVersion):
+		reason = fmt.Sprintf("version %s is deprecated", currentVersion.String())
+	default:
+		return nil
+	}
+
+	return &Deprecation{
+		Reason:      reason,
+		Replacement: findReplacementRepository(ctx, dep, repos, settings),
+	}
+}
+
+// findReplacementRepository returns the URL of a configured repository providing the chart without deprecation or
+// an empty string. Only the cached index files of the repositories are considered, both those downloaded by this
+// plugin and by helm repo update.
+func findReplacementRepository(ctx context.Context, dep *chart.Dependency, repos repositories, settings *cli.EnvSettings) string {
+	logger := loggerFrom(ctx)
+	for _, entry := range repos {
+		if isSameRepository(entry.URL, dep.Repository) || isDeprecatedRepository(entry.URL) {
+			continue
+		}
+
+		indexFile, err := repos.cachedIndexFile(entry.URL, settings)
+		if err != nil {
+			logger.Debugf("Ignoring repository %s while looking for a replacement of %s: %s", entry.Name, dep.Name, err)
+			continue
+		}
+		idx, err := indexCacheFrom(ctx).load(ctx, indexFile)
+		if err != nil {
+			logger.Debugf("Ignoring repository %s while looking for a replacement of %s: %s", entry.Name, dep.Name, err)
+			continue
+		}
+
+		if chartVersions, ok := idx.Entries[dep.Name]; ok && len(chartVersions) > 0 && !isChartDeprecated(chartVersions) {
+			return entry.URL
+		}
+	}
+	return ""
+}
+
+// isChartDeprecated checks whether the latest of the given versions is marked as deprecated.
+func isChartDeprecated(chartVersions repo.ChartVersions) bool {
+	var (
+		latest     *semver.Version
+		deprecated bool
+	)
+	for _, cv := range chartVersions {
+		if cv.Metadata == nil {
+			continue
+		}
+		v, err := semver.NewVersion(cv.Version)
+		if err != nil || v.Prerelease() != "" {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+			deprecated = cv.Deprecated
+		}
+	}
+	return deprecated
+}
+
+// isVersionDeprecated checks whether the given version is marked as deprecated.
+func isVersionDeprecated(chartVersions repo.ChartVersions, version *semver.Version) bool {
+	for _, cv := range chartVersions {
+		if cv.Metadata == nil {
+			continue
+		}
+		if v, err := semver.NewVersion(cv.Version); err == nil && v.Equal(version) {
+			return cv.Deprecated
+		}
+	}
+	return false
+}
+
+func isDeprecatedRepository(repository string) bool {
+	for _, r := range deprecatedRepositories {
+		if isSameRepository(r, repository) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSameRepository(a, b string) bool {
+	return strings.TrimSuffix(a, "/") == strings.TrimSuffix(b, "/")
+}
@@ -0,0 +1,105 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/helmpath"
+)
+
+func TestFindDeprecation(t *testing.T) {
+	tests := []struct {
+		name,
+		version,
+		repository,
+		expectedReason string
+	}{
+		{"testdependency", "2.1.0", testRepository, ""},
+		{"testdependency", "1.2.5", testRepository, "version 1.2.5 is deprecated"},
+		{"deprecateddependency", "1.0.0", testRepository, "chart is deprecated"},
+		{"testdependency", "2.1.0", "https://kubernetes-charts.storage.googleapis.com/", "repository is deprecated"},
+	}
+
+	settings := newTestSettings(t)
+	for _, tt := range tests {
+		t.Run(tt.name+"-"+tt.version, func(t *testing.T) {
+			dep := &chart.Dependency{Name: tt.name, Version: tt.version, Repository: testRepository}
+			chartVersions := mustLoadChartVersions(t, dep, settings)
+			dep.Repository = tt.repository
+
+			d := findDeprecation(context.Background(), dep, chartVersions, semver.MustParse(tt.version), nil, settings)
+			if tt.expectedReason == "" {
+				assert.Nil(t, d, "the dependency should not be deprecated")
+				return
+			}
+			require.NotNil(t, d, "the dependency should be deprecated")
+			assert.Equal(t, tt.expectedReason, d.Reason)
+			assert.Empty(t, d.Replacement, "there should be no replacement without configured repositories")
+		})
+	}
+}
+
+func TestFindDeprecationWithReplacement(t *testing.T) {
+	// The index of the other repository is cached by helm repo update or by this plugin.
+	for _, cacheName := range []string{"other", normalizeRepoName("https://charts.evil.corp")} {
+		t.Run(cacheName, func(t *testing.T) {
+			settings := newTestSettings(t)
+			settings.RepositoryConfig = filepath.Join(t.TempDir(), "repositories.yaml")
+			require.NoError(t, ioutil.WriteFile(settings.RepositoryConfig, []byte(`apiVersion: ""
+repositories:
+  - name: evil-corp
+    url: https://repo.evil.corp
+  - name: stable
+    url: https://kubernetes-charts.storage.googleapis.com
+  - name: other
+    url: https://charts.evil.corp
+`), 0644), "there must be no error writing the repositories.yaml")
+			require.NoError(t, ioutil.WriteFile(filepath.Join(settings.RepositoryCache, helmpath.CacheIndexFile(cacheName)), []byte(`apiVersion: v1
+entries:
+  deprecateddependency:
+    - name: deprecateddependency
+      version: 2.0.0
+      urls: [https://charts.evil.corp/deprecateddependency-2.0.0.tgz]
+`), 0644), "there must be no error writing the cached repository index")
+
+			repos, err := loadRepositories(context.Background(), settings)
+			require.NoError(t, err, "there must be no error loading the repositories")
+
+			dep := &chart.Dependency{Name: "deprecateddependency", Version: "1.0.0", Repository: testRepository}
+			d := findDeprecation(context.Background(), dep, mustLoadChartVersions(t, dep, settings), semver.MustParse(dep.Version), repos, settings)
+			require.NotNil(t, d, "the dependency should be deprecated")
+			assert.Equal(t, "https://charts.evil.corp", d.Replacement, "the chart from the other repository should be suggested")
+			assert.Equal(t, "chart is deprecated, use https://charts.evil.corp", d.String())
+
+			dep = &chart.Dependency{Name: "testdependency", Version: "1.2.5", Repository: testRepository}
+			d = findDeprecation(context.Background(), dep, mustLoadChartVersions(t, dep, settings), semver.MustParse(dep.Version), repos, settings)
+			require.NotNil(t, d, "the version should be deprecated")
+			assert.Empty(t, d.Replacement, "there should be no replacement if no other repository provides the chart")
+		})
+	}
+}
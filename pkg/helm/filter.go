@@ -31,12 +31,18 @@ type Filter struct {
 
 // FilterDependencies ...
 func (f *Filter) FilterDependencies(dependencies []*chart.Dependency) []*chart.Dependency {
+	return f.filterDependencies(dependencies, nil)
+}
+
+// filterDependencies filters the dependencies. Repositories are matched by a part of their URL or the name of the
+// configured repository.
+func (f *Filter) filterDependencies(dependencies []*chart.Dependency, repos repositories) []*chart.Dependency {
 	var filteredDeps []*chart.Dependency
 	for _, dep := range dependencies {
 		keep := true
 
 		// Filter by repositories.
-		if f.Repositories != nil && len(f.Repositories) > 0 && !stringSliceContains(f.Repositories, dep.Repository) {
+		if f.Repositories != nil && len(f.Repositories) > 0 && !stringSliceContains(f.Repositories, dep.Repository) && !f.matchesRepositoryName(repos.name(dep.Repository)) {
 			keep = false
 		}
 
@@ -52,3 +58,15 @@ func (f *Filter) FilterDependencies(dependencies []*chart.Dependency) []*chart.D
 
 	return filteredDeps
 }
+
+func (f *Filter) matchesRepositoryName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range f.Repositories {
+		if normalizeString(r) == normalizeString(name) {
+			return true
+		}
+	}
+	return false
+}
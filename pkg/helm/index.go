@@ -0,0 +1,284 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+// indexMetadata is stored next to a cached index, so that it can be revalidated using a conditional request.
+type indexMetadata struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+// indexMetadataFile returns the path of the metadata of the given cached index.
+func indexMetadataFile(indexFile string) string {
+	return indexFile + ".meta"
+}
+
+// updateIndexFile downloads the index of the repository into the cache directory and returns its path.
+// A cached index fetched less than maxAge ago is used as is. Otherwise it is revalidated using the ETag or
+// Last-Modified header of the previous response, so unchanged indexes are not downloaded again.
+// Transient errors are retried until the context is done.
+func updateIndexFile(ctx context.Context, entry *repo.Entry, cacheDir string, maxAge time.Duration) (string, error) {
+	indexFile := filepath.Join(cacheDir, helmpath.CacheIndexFile(entry.Name))
+	logger := loggerFrom(ctx)
+	meta := readIndexMetadata(ctx, indexFile)
+
+	if meta != nil && maxAge > 0 {
+		if age := now().Sub(meta.Fetched); age < maxAge {
+			logger.Debugf("Cache hit for repository %s, index was fetched %s ago", entry.URL, age.Round(time.Second))
+			return indexFile, nil
+		}
+	}
+
+	client, err := httpClientsFrom(ctx).get(entry)
+	if err != nil {
+		return "", err
+	}
+
+	indexURL, err := url.Parse(entry.URL)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid repository URL %s", entry.URL)
+	}
+	indexURL.RawPath = path.Join(indexURL.RawPath, "index.yaml")
+	indexURL.Path = path.Join(indexURL.Path, "index.yaml")
+
+	res, err := doWithRetry(ctx, client, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, indexURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", "helm-outdated")
+		if entry.Username != "" && entry.Password != "" {
+			req.SetBasicAuth(entry.Username, entry.Password)
+		}
+		if meta != nil {
+			if meta.ETag != "" {
+				req.Header.Set("If-None-Match", meta.ETag)
+			}
+			if meta.LastModified != "" {
+				req.Header.Set("If-Modified-Since", meta.LastModified)
+			}
+		}
+		return req, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		if meta == nil {
+			return "", fmt.Errorf("unexpected response %s from %s", res.Status, indexURL.String())
+		}
+		logger.Debugf("Cache hit for repository %s, index was not modified", entry.URL)
+		meta.Fetched = now()
+		return indexFile, writeIndexMetadata(indexFile, meta)
+
+	case http.StatusOK:
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return "", err
+		}
+		idx, err := parseIndex(data)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid index of repository %s", entry.URL)
+		}
+		logger.Debugf("Cache miss for repository %s, downloaded %d bytes", entry.URL, len(data))
+
+		metaData, err := json.Marshal(&indexMetadata{
+			ETag:         res.Header.Get("ETag"),
+			LastModified: res.Header.Get("Last-Modified"),
+			Fetched:      now(),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if err := os.MkdirAll(cacheDir, 0755); err != nil {
+			return "", err
+		}
+		tx := &fileTransaction{}
+		tx.Stage(indexFile, data)
+		tx.Stage(indexMetadataFile(indexFile), metaData)
+		if err := tx.Commit(); err != nil {
+			return "", err
+		}
+
+		// The index was parsed to validate it, so it is not parsed again when resolving the dependencies.
+		indexCacheFrom(ctx).put(indexFile, idx)
+		return indexFile, nil
+	}
+
+	return "", fmt.Errorf("failed to fetch %s : %s", indexURL.String(), res.Status)
+}
+
+// parseIndex parses the data like repo.LoadIndexFile parses an index file.
+func parseIndex(data []byte) (*repo.IndexFile, error) {
+	idx := &repo.IndexFile{}
+	if err := yaml.UnmarshalStrict(data, idx); err != nil {
+		return nil, err
+	}
+	idx.SortEntries()
+	if idx.APIVersion == "" {
+		return nil, repo.ErrNoAPIVersion
+	}
+	return idx, nil
+}
+
+// readIndexMetadata returns the metadata of the cached index or nil if the index or its metadata do not exist.
+func readIndexMetadata(ctx context.Context, indexFile string) *indexMetadata {
+	if !fileExists(indexFile) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(indexMetadataFile(indexFile))
+	if err != nil {
+		return nil
+	}
+
+	meta := &indexMetadata{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		loggerFrom(ctx).Debugf("Ignoring invalid metadata of cached index %s: %s", indexFile, err)
+		return nil
+	}
+	return meta
+}
+
+func writeIndexMetadata(indexFile string, meta *indexMetadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	tx := &fileTransaction{}
+	tx.Stage(indexMetadataFile(indexFile), data)
+	return tx.Commit()
+}
+
+// tlsOptions are the TLS settings of a repository.
+type tlsOptions struct {
+	certFile, keyFile, caFile string
+	insecureSkipTLSVerify     bool
+}
+
+// httpClients reuses one client per TLS configuration, so connections are kept alive across repositories and retries.
+type httpClients struct {
+	mu      sync.Mutex
+	clients map[tlsOptions]*http.Client
+}
+
+func newHTTPClients() *httpClients {
+	return &httpClients{clients: map[tlsOptions]*http.Client{}}
+}
+
+// get returns the client for the TLS settings of the repository.
+func (c *httpClients) get(entry *repo.Entry) (*http.Client, error) {
+	key := tlsOptions{certFile: entry.CertFile, keyFile: entry.KeyFile, caFile: entry.CAFile, insecureSkipTLSVerify: entry.InsecureSkipTLSverify}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[key]; ok {
+		return client, nil
+	}
+	client, err := newHTTPClient(entry)
+	if err != nil {
+		return nil, err
+	}
+	c.clients[key] = client
+	return client, nil
+}
+
+// closeIdleConnections closes the idle connections of all clients.
+func (c *httpClients) closeIdleConnections() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, client := range c.clients {
+		client.CloseIdleConnections()
+	}
+}
+
+type httpClientsKey struct{}
+
+// withHTTPClients returns a context carrying the clients.
+func withHTTPClients(ctx context.Context, clients *httpClients) context.Context {
+	return context.WithValue(ctx, httpClientsKey{}, clients)
+}
+
+// httpClientsFrom returns the clients carried by the context or new ones, which are not reused.
+func httpClientsFrom(ctx context.Context) *httpClients {
+	if clients, ok := ctx.Value(httpClientsKey{}).(*httpClients); ok {
+		return clients
+	}
+	return newHTTPClients()
+}
+
+// newHTTPClient returns a client using the TLS settings of the repository.
+func newHTTPClient(entry *repo.Entry) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: entry.InsecureSkipTLSverify}
+
+	if entry.CertFile != "" && entry.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(entry.CertFile, entry.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if entry.CAFile != "" {
+		data, err := ioutil.ReadFile(entry.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't read CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", entry.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}, nil
+}
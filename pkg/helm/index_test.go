@@ -0,0 +1,187 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// testIndexServer serves an index with an ETag and Last-Modified header and counts the full downloads.
+type testIndexServer struct {
+	*httptest.Server
+	index        []byte
+	etag         string
+	lastModified time.Time
+	requests     int
+	downloads    int
+}
+
+func newTestIndexServer(t *testing.T) *testIndexServer {
+	index, err := ioutil.ReadFile(filepath.Join("fixtures", "repository", "index.yaml"))
+	require.NoError(t, err, "there must be no error reading the repository index")
+
+	s := &testIndexServer{
+		index:        index,
+		etag:         `"v1"`,
+		lastModified: time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests++
+		if r.URL.Path != "/index.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if s.etag != "" {
+			w.Header().Set("ETag", s.etag)
+		}
+		w.Header().Set("Last-Modified", s.lastModified.Format(http.TimeFormat))
+		if s.etag != "" && r.Header.Get("If-None-Match") == s.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && r.Header.Get("If-None-Match") == "" && !s.lastModified.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		s.downloads++
+		w.Write(s.index)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestUpdateIndexFile(t *testing.T) {
+	defer func(n func() time.Time) { now = n }(now)
+	current := time.Date(2020, 12, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+
+	srv := newTestIndexServer(t)
+	cacheDir := t.TempDir()
+	entry := &repo.Entry{Name: "test", URL: srv.URL}
+
+	indexFile, err := updateIndexFile(context.Background(), entry, cacheDir, time.Hour)
+	require.NoError(t, err, "there should be no error downloading the index")
+	assert.Equal(t, 1, srv.downloads, "the index should have been downloaded")
+	idx, err := repo.LoadIndexFile(indexFile)
+	require.NoError(t, err, "the cached index should be valid")
+	assert.Contains(t, idx.Entries, "testdependency")
+
+	// The index is fresh.
+	current = current.Add(30 * time.Minute)
+	_, err = updateIndexFile(context.Background(), entry, cacheDir, time.Hour)
+	require.NoError(t, err, "there should be no error using the cached index")
+	assert.Equal(t, 1, srv.requests, "the repository should not be requested for a fresh index")
+
+	// The index is stale but unchanged.
+	current = current.Add(time.Hour)
+	_, err = updateIndexFile(context.Background(), entry, cacheDir, time.Hour)
+	require.NoError(t, err, "there should be no error revalidating the index")
+	assert.Equal(t, 2, srv.requests, "the repository should be requested for a stale index")
+	assert.Equal(t, 1, srv.downloads, "an unchanged index should not be downloaded again")
+
+	// Revalidation resets the age of the index.
+	current = current.Add(30 * time.Minute)
+	_, err = updateIndexFile(context.Background(), entry, cacheDir, time.Hour)
+	require.NoError(t, err, "there should be no error using the cached index")
+	assert.Equal(t, 2, srv.requests, "the revalidated index should be fresh")
+
+	// Without a max age the index is always revalidated.
+	_, err = updateIndexFile(context.Background(), entry, cacheDir, 0)
+	require.NoError(t, err, "there should be no error revalidating the index")
+	assert.Equal(t, 3, srv.requests, "the index should be revalidated")
+	assert.Equal(t, 1, srv.downloads, "an unchanged index should not be downloaded again")
+
+	// The index changed.
+	srv.etag = `"v2"`
+	srv.index = []byte("apiVersion: v1\nentries: {}\n")
+	_, err = updateIndexFile(context.Background(), entry, cacheDir, 0)
+	require.NoError(t, err, "there should be no error downloading the changed index")
+	assert.Equal(t, 2, srv.downloads, "the changed index should be downloaded")
+	idx, err = repo.LoadIndexFile(indexFile)
+	require.NoError(t, err, "the cached index should be valid")
+	assert.Empty(t, idx.Entries, "the changed index should have been cached")
+}
+
+func TestUpdateIndexFileLastModified(t *testing.T) {
+	srv := newTestIndexServer(t)
+	srv.etag = ""
+	cacheDir := t.TempDir()
+	entry := &repo.Entry{Name: "test", URL: srv.URL + "/"}
+
+	for i := 0; i < 2; i++ {
+		_, err := updateIndexFile(context.Background(), entry, cacheDir, 0)
+		require.NoError(t, err, "there should be no error updating the index")
+	}
+	assert.Equal(t, 2, srv.requests, "the index should have been revalidated")
+	assert.Equal(t, 1, srv.downloads, "an unmodified index should not be downloaded again")
+}
+
+func TestUpdateIndexFileInvalid(t *testing.T) {
+	srv := newTestIndexServer(t)
+	srv.index = []byte("not: an index\n")
+	cacheDir := t.TempDir()
+
+	_, err := updateIndexFile(context.Background(), &repo.Entry{Name: "test", URL: srv.URL}, cacheDir, 0)
+	assert.Error(t, err, "an invalid index should be rejected")
+	assert.False(t, fileExists(filepath.Join(cacheDir, "test-index.yaml")), "an invalid index should not be cached")
+}
+
+func TestUpdateIndexFileCachesParsedIndex(t *testing.T) {
+	indexes := newIndexCache()
+	ctx := withIndexCache(context.Background(), indexes)
+
+	srv := newTestIndexServer(t)
+	indexFile, err := updateIndexFile(ctx, &repo.Entry{Name: "test", URL: srv.URL}, t.TempDir(), 0)
+	require.NoError(t, err, "there should be no error downloading the index")
+
+	e, ok := indexes.entries[indexFile]
+	require.True(t, ok, "the downloaded index should be cached")
+	idx, err := indexes.load(ctx, indexFile)
+	require.NoError(t, err, "there should be no error loading the cached index")
+	assert.Same(t, e.index, idx, "the downloaded index should not be parsed again")
+	assert.Contains(t, idx.Entries, "testdependency")
+}
+
+func TestHTTPClientsReused(t *testing.T) {
+	clients := newHTTPClients()
+	defer clients.closeIdleConnections()
+
+	a, err := clients.get(&repo.Entry{Name: "a", URL: "https://a.corp"})
+	require.NoError(t, err, "there should be no error creating the client")
+	b, err := clients.get(&repo.Entry{Name: "b", URL: "https://b.corp"})
+	require.NoError(t, err, "there should be no error getting the client")
+	assert.Same(t, a, b, "repositories with the same TLS settings should share the client")
+
+	c, err := clients.get(&repo.Entry{Name: "c", URL: "https://c.corp", InsecureSkipTLSverify: true})
+	require.NoError(t, err, "there should be no error creating the client")
+	assert.NotSame(t, a, c, "repositories with other TLS settings should not share the client")
+}
@@ -0,0 +1,149 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+// writeJUnit writes the results of the chart in the given path as JUnit XML report. The chart is a test suite and every
+// dependency a test case, which fails if the dependency is outdated beyond the threshold. Dependencies which could not
+// be checked are errors.
+func writeJUnit(w io.Writer, chartPath string, results []*Result, threshold IncType) error {
+	chartName, err := GetChartName(chartPath)
+	if err != nil {
+		return err
+	}
+
+	suite := junitTestSuite{
+		Name:       chartName,
+		Properties: []junitProperty{{Name: "chartPath", Value: chartPath}},
+	}
+	for _, r := range results {
+		name := r.Name
+		if r.Alias != "" {
+			name = fmt.Sprintf("%s (%s)", r.Alias, r.Name)
+		}
+
+		tc := junitTestCase{Name: name, ClassName: chartName}
+		switch {
+		case r.Failed():
+			suite.Errors++
+			tc.Error = &junitMessage{
+				Message: fmt.Sprintf("%s could not be checked: %s", name, r.Status),
+				Type:    string(r.Status),
+				Text:    r.Err.Error(),
+			}
+		case r.IsOutdatedBeyond(threshold):
+			suite.Failures++
+			bump := GetIncType(r.CurrentVersion, r.LatestVersion)
+			tc.Failure = &junitMessage{
+				Message: fmt.Sprintf("%s is outdated: current version %s, latest version %s", name, versionString(r.CurrentVersion), r.LatestVersion.String()),
+				Type:    string(bump),
+				Text:    junitDetails(r, bump),
+			}
+		default:
+			tc.SystemOut = &junitOutput{Text: junitDetails(r, "")}
+		}
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{
+		Name:     toolName,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Suites:   []junitTestSuite{suite},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// junitDetails returns the versions of the dependency, one per line.
+func junitDetails(r *Result, bump IncType) string {
+	lines := []string{
+		"repository: " + r.Repository,
+		"version: " + r.Version,
+		"current version: " + formatVersion(r.CurrentVersion),
+		"latest version: " + formatVersion(r.LatestVersion),
+	}
+	if bump != "" {
+		lines = append(lines, "bump: "+string(bump))
+	}
+	if r.Deprecation != nil {
+		lines = append(lines, "deprecated: "+r.Deprecation.String())
+	}
+	if r.Cooldown != nil {
+		lines = append(lines, "cooldown: "+r.Cooldown.String())
+	}
+	return strings.Join(lines, "\n")
+}
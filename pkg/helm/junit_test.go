@@ -0,0 +1,65 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultIsOutdatedBeyond(t *testing.T) {
+	testCases := []struct {
+		current, latest string
+		threshold       IncType
+		expected        bool
+	}{
+		{current: "1.0.0", latest: "1.0.1", threshold: "", expected: true},
+		{current: "1.0.0", latest: "1.0.1", threshold: IncTypes.Patch, expected: true},
+		{current: "1.0.0", latest: "1.0.1", threshold: IncTypes.Minor, expected: false},
+		{current: "1.0.0", latest: "1.1.0", threshold: IncTypes.Minor, expected: true},
+		{current: "1.0.0", latest: "2.0.0", threshold: IncTypes.Minor, expected: true},
+		{current: "1.0.0", latest: "1.9.0", threshold: IncTypes.Major, expected: false},
+		{current: "1.0.0-rc.1", latest: "1.0.0", threshold: IncTypes.Patch, expected: true},
+		{current: "1.0.0-rc.1", latest: "1.0.0", threshold: IncTypes.Minor, expected: false},
+		{current: "1.0.0", latest: "1.0.0", threshold: IncTypes.Patch, expected: false},
+	}
+
+	for _, tc := range testCases {
+		r := newOutdatedResult("test", tc.current, tc.latest)
+		assert.Equal(t, tc.expected, r.IsOutdatedBeyond(tc.threshold), "wrong result for %s -> %s with threshold %q", tc.current, tc.latest, tc.threshold)
+	}
+}
+
+func TestWriteJUnitThreshold(t *testing.T) {
+	chartPath, _ := newTestOutputResults()
+	results := []*Result{
+		newOutdatedResult("minor", "1.0.0", "1.1.0"),
+		newOutdatedResult("major", "1.0.0", "2.0.0"),
+	}
+
+	var buf bytes.Buffer
+	err := WriteOutput(&buf, OutputFormats.JUnit, chartPath, results, OutputOptions{FailThreshold: IncTypes.Major})
+	require.NoError(t, err, "there should be no error writing the report")
+	assert.Contains(t, buf.String(), `<testsuite name="chart-v2" tests="2" failures="1" errors="0">`, "only the major update should fail")
+	assert.Contains(t, buf.String(), `<failure message="major is outdated: current version 1.0.0, latest version 2.0.0" type="major">`)
+}
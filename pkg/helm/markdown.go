@@ -0,0 +1,125 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// writeMarkdown writes the results of the chart in the given path as Markdown, e.g. for the body of a pull request.
+// A table summarizes the changes and a collapsible section per dependency links the home and sources of its latest
+// version. As the metadata of the latest version comes from the repository index, it is escaped and only HTTP(S) URLs
+// are linked.
+func writeMarkdown(w io.Writer, chartPath string, results []*Result, options OutputOptions) error {
+	chartName, err := GetChartName(chartPath)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "### Chart `%s`\n\n", chartName)
+	if len(results) == 0 {
+		buf.WriteString("All charts up to date.\n")
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+
+	if options.Title != "" {
+		fmt.Fprintf(&buf, "%s\n\n", options.Title)
+	}
+	buf.WriteString("| Dependency | From | To | Bump | Repository |\n")
+	buf.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, r := range results {
+		bump := "-"
+		if r.LatestVersion != nil {
+			bump = string(GetIncType(r.CurrentVersion, r.LatestVersion))
+		}
+		fmt.Fprintf(&buf, "| %s | %s | %s | %s | %s |\n",
+			markdownCell(markdownName(r)), markdownCell(r.Version), markdownCell(formatVersion(r.LatestVersion)), bump, markdownCell(r.Repository))
+	}
+
+	for _, r := range results {
+		fmt.Fprintf(&buf, "\n<details>\n<summary><b>%s</b> %s &rarr; %s</summary>\n\n",
+			htmlEscaper.Replace(markdownName(r)), htmlEscaper.Replace(r.Version), htmlEscaper.Replace(formatVersion(r.LatestVersion)))
+
+		status := formatStatus(r)
+		if status == "" {
+			status = string(r.Status)
+		}
+		fmt.Fprintf(&buf, "- Status: %s\n", markdownText(status))
+		if r.LatestChart != nil {
+			if r.LatestChart.Description != "" {
+				fmt.Fprintf(&buf, "- Description: %s\n", markdownText(r.LatestChart.Description))
+			}
+			if r.LatestChart.Home != "" {
+				fmt.Fprintf(&buf, "- Home: %s\n", markdownLink(r.LatestChart.Home))
+			}
+			for _, source := range r.LatestChart.Sources {
+				fmt.Fprintf(&buf, "- Source: %s\n", markdownLink(source))
+			}
+		}
+		if r.Position != nil {
+			fmt.Fprintf(&buf, "- Declared in: `%s` line %d\n", r.Position.File, r.Position.Line)
+		}
+		buf.WriteString("\n</details>\n")
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// markdownName returns the alias and name of the dependency.
+func markdownName(r *Result) string {
+	if r.Alias != "" {
+		return fmt.Sprintf("%s (%s)", r.Alias, r.Name)
+	}
+	return r.Name
+}
+
+// markdownCell escapes the value for a table cell.
+func markdownCell(value string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(value)
+}
+
+var markdownEscaper = strings.NewReplacer(
+	"&", "&amp;", "<", "&lt;", ">", "&gt;",
+	"\r\n", " ", "\n", " ", "\r", " ",
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "|", `\|`,
+)
+
+// markdownText escapes the value so it is rendered as a single line of plain text.
+func markdownText(value string) string {
+	return markdownEscaper.Replace(value)
+}
+
+// markdownLink returns the URL as autolink if it is an HTTP(S) URL and as plain text otherwise.
+func markdownLink(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.ContainsAny(value, "<>\"'` \t\r\n") {
+		return markdownText(value)
+	}
+	return "<" + value + ">"
+}
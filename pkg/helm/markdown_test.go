@@ -0,0 +1,50 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestWriteMarkdownEscapesIndexMetadata(t *testing.T) {
+	chartPath, _ := newTestOutputResults()
+	r := newOutdatedResult("testdependency", "0.0.1", "2.1.0")
+	r.Status = Statuses.Outdated
+	r.LatestChart = &chart.Metadata{
+		Name:        "testdependency",
+		Version:     "2.1.0",
+		Description: "Breaks | tables\n</details><script>alert(1)</script>\n[click](https://evil.corp) *now*",
+		Home:        "javascript:alert(1)",
+		Sources: []string{
+			"https://github.com/evil-corp/testdependency",
+			"https://evil.corp/><img src=x>",
+			"ftp://evil.corp/testdependency",
+		},
+	}
+
+	var buf bytes.Buffer
+	err := WriteOutput(&buf, OutputFormats.Markdown, chartPath, []*Result{r}, OutputOptions{})
+	require.NoError(t, err, "there should be no error writing the output")
+	assertGolden(t, "results.escaped.md", buf.Bytes())
+}
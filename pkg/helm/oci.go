@@ -0,0 +1,396 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+const ociPrefix = "oci://"
+
+// loadOCIChartVersions returns the versions of the chart with the given name found in the OCI registry of the request.
+// The chart is expected at <registry>/<name> and its versions are the tags which are semantic versions.
+// Credentials are taken from the registry config used by `helm registry login`. The registry is accessed using the
+// TLS settings of the request or via plain HTTP if RepositoryOptions.PlainHTTP is set.
+func loadOCIChartVersions(ctx context.Context, req *SourceRequest, name string) (repo.ChartVersions, error) {
+	client, err := httpClientsFrom(ctx).get(req.Entry)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := strings.TrimSuffix(strings.TrimPrefix(req.Repository, ociPrefix), "/")
+	idx := strings.Index(ref, "/")
+	if idx < 0 {
+		idx = len(ref)
+	}
+	host, repository := ref[:idx], strings.TrimPrefix(path.Join(ref[idx:], name), "/")
+
+	c := &ociClient{
+		ctx:         ctx,
+		client:      client,
+		scheme:      "https",
+		host:        host,
+		credentials: registryCredentials(ctx, req.Settings.RegistryConfig, host),
+	}
+	if req.Options != nil && req.Options.PlainHTTP {
+		c.scheme = "http"
+	}
+
+	tags, err := c.listTags(repository)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list tags of %s%s/%s", ociPrefix, host, repository)
+	}
+
+	var chartVersions repo.ChartVersions
+	for _, tag := range tags {
+		// OCI tags cannot contain a +, so Helm replaces it with an _ when pushing charts.
+		version := strings.ReplaceAll(tag, "_", "+")
+		if _, err := semver.NewVersion(version); err != nil {
+			loggerFrom(ctx).Debugf("Ignoring tag %s of %s as it is no semantic version", tag, name)
+			continue
+		}
+		chartVersions = append(chartVersions, &repo.ChartVersion{
+			Metadata: &chart.Metadata{Name: name, Version: version},
+			URLs:     []string{fmt.Sprintf("%s%s/%s:%s", ociPrefix, host, repository, tag)},
+		})
+	}
+
+	if len(chartVersions) == 0 {
+		return nil, repo.ErrNoChartVersion
+	}
+	return chartVersions, nil
+}
+
+// ociCredentials are the username and password for a registry.
+type ociCredentials struct {
+	username, password string
+}
+
+// ociClient lists tags using the OCI distribution API.
+type ociClient struct {
+	// ctx bounds all requests of the client.
+	ctx    context.Context
+	client *http.Client
+	// scheme is https unless the registry is accessed via plain HTTP.
+	scheme      string
+	host        string
+	credentials *ociCredentials
+	token       string
+}
+
+// listTags returns all tags of the given repository following the pagination of the registry.
+func (c *ociClient) listTags(repository string) ([]string, error) {
+	first, err := url.Parse(fmt.Sprintf("%s://%s/v2/%s/tags/list", c.scheme, c.host, repository))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		tags []string
+		next = first.String()
+	)
+	for next != "" {
+		res, err := c.get(next, repository)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid tag list")
+		}
+		tags = append(tags, page.Tags...)
+
+		if next, err = nextPage(res, first); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// get requests the URL and authenticates if the registry asks for it.
+func (c *ociClient) get(u, repository string) (*http.Response, error) {
+	res, err := c.do(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusUnauthorized {
+		res.Body.Close()
+		if err := c.authenticate(res.Header.Get("WWW-Authenticate"), repository); err != nil {
+			return nil, err
+		}
+		if res, err = c.do(u); err != nil {
+			return nil, err
+		}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("unexpected response %s from %s", res.Status, u)
+	}
+	return res, nil
+}
+
+func (c *ociClient) do(u string) (*http.Response, error) {
+	return doWithRetry(c.ctx, c.client, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+
+		switch {
+		case c.token != "":
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		case c.credentials != nil:
+			req.SetBasicAuth(c.credentials.username, c.credentials.password)
+		}
+		return req, nil
+	})
+}
+
+// authenticate handles the challenge of the registry. For basic authentication the credentials are sent with the
+// next request. For bearer authentication a token with pull access to the repository is requested.
+func (c *ociClient) authenticate(challenge, repository string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.credentials == nil {
+			return fmt.Errorf("registry %s requires credentials, use helm registry login", c.host)
+		}
+		return nil
+
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || params["realm"] == "" {
+			return fmt.Errorf("invalid authentication challenge %q", challenge)
+		}
+		q := realm.Query()
+		if service, ok := params["service"]; ok {
+			q.Set("service", service)
+		}
+		q.Set("scope", fmt.Sprintf("repository:%s:pull", repository))
+		realm.RawQuery = q.Encode()
+
+		res, err := doWithRetry(c.ctx, c.client, func() (*http.Request, error) {
+			req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+			if err != nil {
+				return nil, err
+			}
+			if c.credentials != nil {
+				req.SetBasicAuth(c.credentials.username, c.credentials.password)
+			}
+			return req, nil
+		})
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to get a token for %s from %s: %s", repository, realm.Host, res.Status)
+		}
+
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+			return errors.Wrap(err, "invalid token response")
+		}
+		c.token = token.Token
+		if c.token == "" {
+			c.token = token.AccessToken
+		}
+		if c.token == "" {
+			return fmt.Errorf("no token for %s received from %s", repository, realm.Host)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported authentication challenge %q", challenge)
+}
+
+// parseChallenge parses a WWW-Authenticate header like Bearer realm="https://auth.example.com",service="registry" .
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	challenge = strings.TrimSpace(challenge)
+	idx := strings.IndexByte(challenge, ' ')
+	if idx < 0 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:idx], challenge[idx+1:]
+
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var buf strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				buf.WriteByte(rest[i])
+			}
+			value = buf.String()
+			if i < len(rest) {
+				i++
+			}
+			rest = rest[i:]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value = strings.TrimSpace(rest[:end])
+			rest = rest[end:]
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
+
+// nextPage returns the URL of the next page announced in the Link header of the response or an empty string.
+// As the credentials are sent with every request, the next page must be served by the registry itself, which is
+// identified by the scheme and host of the given URL of the first page.
+func nextPage(res *http.Response, registry *url.URL) (string, error) {
+	link := res.Header.Get("Link")
+	if link == "" {
+		return "", nil
+	}
+
+	start, end := strings.IndexByte(link, '<'), strings.IndexByte(link, '>')
+	if start < 0 || end < start || !strings.Contains(link[end:], `rel="next"`) {
+		return "", nil
+	}
+
+	next, err := registry.Parse(link[start+1 : end])
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid link %q", link)
+	}
+	if next.Scheme != registry.Scheme || next.Host != registry.Host {
+		return "", fmt.Errorf("refusing to follow the link %q to another host than %s", link, registry.Host)
+	}
+	return next.String(), nil
+}
+
+// registryCredentials returns the credentials for the host from the registry config or nil.
+// The config has the format of the Docker config.json including credential helpers. It is read here as the registry
+// client of Helm 3.4, which would handle it, is internal to Helm.
+func registryCredentials(ctx context.Context, registryConfig, host string) *ociCredentials {
+	logger := loggerFrom(ctx)
+	data, err := ioutil.ReadFile(registryConfig)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Debugf("Failed to read registry config %s: %s", registryConfig, err)
+		}
+		return nil
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		logger.Debugf("Failed to parse registry config %s: %s", registryConfig, err)
+		return nil
+	}
+
+	helper := config.CredsStore
+	if h, ok := config.CredHelpers[host]; ok {
+		helper = h
+	}
+	if helper != "" {
+		return credentialsFromHelper(ctx, helper, host)
+	}
+
+	for key, auth := range config.Auths {
+		if strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://") != host {
+			continue
+		}
+		if auth.Username != "" {
+			return &ociCredentials{username: auth.Username, password: auth.Password}
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			logger.Debugf("Invalid credentials for %s in %s: %s", host, registryConfig, err)
+			return nil
+		}
+		if idx := strings.IndexByte(string(decoded), ':'); idx >= 0 {
+			return &ociCredentials{username: string(decoded[:idx]), password: string(decoded[idx+1:])}
+		}
+	}
+	return nil
+}
+
+// credentialsFromHelper gets the credentials for the host from the docker-credential-<helper> program.
+func credentialsFromHelper(ctx context.Context, helper, host string) *ociCredentials {
+	logger := loggerFrom(ctx)
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(host)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		logger.Debugf("Failed to get credentials for %s from docker-credential-%s: %s", host, helper, err)
+		return nil
+	}
+
+	var creds struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &creds); err != nil {
+		logger.Debugf("Invalid credentials for %s from docker-credential-%s: %s", host, helper, err)
+		return nil
+	}
+	return &ociCredentials{username: creds.Username, password: creds.Secret}
+}
@@ -0,0 +1,266 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+)
+
+const (
+	testRegistryUser     = "evil"
+	testRegistryPassword = "corp"
+	testRegistryToken    = "pull-token"
+)
+
+// newTestRegistry starts a registry serving the tags of charts/testdependency via HTTPS or plain HTTP.
+// With bearer authentication, tokens are issued by the /token endpoint, otherwise basic authentication is required.
+func newTestRegistry(t *testing.T, bearer, plainHTTP bool) *httptest.Server {
+	tags := []string{"1.2.0", "1.2.5", "latest", "2.0.0", "2.1.0_build.1", "3.0.0-rc.1", "sha256-1234"}
+
+	var srv *httptest.Server
+	srv = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, hasBasicAuth := r.BasicAuth()
+		validBasicAuth := hasBasicAuth && user == testRegistryUser && password == testRegistryPassword
+
+		if r.URL.Path == "/token" {
+			if !validBasicAuth || r.URL.Query().Get("scope") != "repository:charts/testdependency:pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"token": testRegistryToken})
+			return
+		}
+
+		authorized := validBasicAuth
+		if bearer {
+			authorized = r.Header.Get("Authorization") == "Bearer "+testRegistryToken
+		}
+		if !authorized {
+			if bearer {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry",scope="repository:charts/testdependency:pull"`, srv.URL))
+			} else {
+				w.Header().Set("WWW-Authenticate", `Basic realm="test-registry"`)
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path != "/v2/charts/testdependency/tags/list" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// Serve pages of 3 tags.
+		start, _ := strconv.Atoi(r.URL.Query().Get("last"))
+		end := start + 3
+		if end < len(tags) {
+			w.Header().Set("Link", fmt.Sprintf(`</v2/charts/testdependency/tags/list?n=3&last=%d>; rel="next"`, end))
+		} else {
+			end = len(tags)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": "charts/testdependency", "tags": tags[start:end]})
+	}))
+	if plainHTTP {
+		srv.Start()
+	} else {
+		srv.StartTLS()
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestRegistryOptions returns repository options trusting the certificate of the test servers.
+func newTestRegistryOptions(t *testing.T, srv *httptest.Server) *RepositoryOptions {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t,
+		ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644),
+		"there must be no error writing the CA file",
+	)
+	return &RepositoryOptions{Credentials: &RepositoryCredentials{CAFile: caFile}}
+}
+
+// newTestRegistrySettings returns settings with a registry config containing the credentials for the registry.
+func newTestRegistrySettings(t *testing.T, host string) *cli.EnvSettings {
+	settings := newTestSettings(t)
+	settings.RegistryConfig = filepath.Join(t.TempDir(), "registry.json")
+
+	auth := base64.StdEncoding.EncodeToString([]byte(testRegistryUser + ":" + testRegistryPassword))
+	require.NoError(t,
+		ioutil.WriteFile(settings.RegistryConfig, []byte(fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, host, auth)), 0644),
+		"there must be no error writing the registry config",
+	)
+	return settings
+}
+
+func TestLoadOCIChartVersions(t *testing.T) {
+	for _, bearer := range []bool{true, false} {
+		t.Run("bearer="+strconv.FormatBool(bearer), func(t *testing.T) {
+			srv := newTestRegistry(t, bearer, false)
+			host := strings.TrimPrefix(srv.URL, "https://")
+
+			dep := &chart.Dependency{Name: "testdependency", Version: "1.2.0", Repository: "oci://" + host + "/charts"}
+			chartVersions, err := loadChartVersions(context.Background(), dep, nil, newTestRegistrySettings(t, host), newTestRegistryOptions(t, srv))
+			require.NoError(t, err, "there should be no error listing the tags")
+
+			var versions []string
+			for _, cv := range chartVersions {
+				versions = append(versions, cv.Version)
+			}
+			assert.Equal(t, []string{"1.2.0", "1.2.5", "2.0.0", "2.1.0+build.1", "3.0.0-rc.1"}, versions, "only semantic versions should be returned")
+			assert.Equal(t, "oci://"+host+"/charts/testdependency:2.1.0_build.1", chartVersions[3].URLs[0])
+
+			constraint := mustConstraint(t, dep.Version)
+			_, latestVersion, _, err := findLatestVersionOfDependency(context.Background(), dep, chartVersions, constraint, nil)
+			require.NoError(t, err, "there should be no error finding the latest version")
+			assert.Equal(t, "2.1.0+build.1", latestVersion.String())
+		})
+	}
+}
+
+func TestLoadOCIChartVersionsPlainHTTP(t *testing.T) {
+	srv := newTestRegistry(t, false, true)
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	dep := &chart.Dependency{Name: "testdependency", Version: "1.2.0", Repository: "oci://" + host + "/charts"}
+	chartVersions, err := loadChartVersions(context.Background(), dep, nil, newTestRegistrySettings(t, host), &RepositoryOptions{PlainHTTP: true})
+	require.NoError(t, err, "there should be no error listing the tags via plain HTTP")
+	assert.Len(t, chartVersions, 5, "all semantic versions should be returned")
+}
+
+func TestLoadOCIChartVersionsUnknownCertificate(t *testing.T) {
+	srv := newTestRegistry(t, false, false)
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	dep := &chart.Dependency{Name: "testdependency", Version: "1.2.0", Repository: "oci://" + host + "/charts"}
+	_, err := loadChartVersions(context.Background(), dep, nil, newTestRegistrySettings(t, host), &RepositoryOptions{})
+	require.Error(t, err, "the certificate of the registry should not be trusted without the CA file")
+	assert.Contains(t, err.Error(), "certificate")
+
+	options := &RepositoryOptions{Credentials: &RepositoryCredentials{InsecureSkipTLSVerify: true}}
+	_, err = loadChartVersions(context.Background(), dep, nil, newTestRegistrySettings(t, host), options)
+	assert.NoError(t, err, "the certificate should not be verified if this is skipped")
+}
+
+func TestLoadOCIChartVersionsUnauthorized(t *testing.T) {
+	srv := newTestRegistry(t, true, false)
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	settings := newTestSettings(t)
+	settings.RegistryConfig = filepath.Join(t.TempDir(), "registry.json")
+
+	dep := &chart.Dependency{Name: "testdependency", Version: "1.2.0", Repository: "oci://" + host + "/charts"}
+	_, err := loadChartVersions(context.Background(), dep, nil, settings, newTestRegistryOptions(t, srv))
+	assert.Error(t, err, "listing the tags should fail without credentials")
+}
+
+func TestLoadOCIChartVersionsLinkToOtherHost(t *testing.T) {
+	// The other host records whether it received the credentials of the registry.
+	var otherAuthorization string
+	other := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherAuthorization = r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(map[string]interface{}{"tags": []string{"9.9.9"}})
+	}))
+	t.Cleanup(other.Close)
+
+	srv := newTestRegistry(t, false, false)
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != testRegistryUser || password != testRegistryPassword {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test-registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s/v2/charts/testdependency/tags/list?n=3&last=3>; rel="next"`, other.URL))
+		json.NewEncoder(w).Encode(map[string]interface{}{"tags": []string{"1.2.0"}})
+	})
+	host := strings.TrimPrefix(srv.URL, "https://")
+
+	dep := &chart.Dependency{Name: "testdependency", Version: "1.2.0", Repository: "oci://" + host + "/charts"}
+	_, err := loadChartVersions(context.Background(), dep, nil, newTestRegistrySettings(t, host), newTestRegistryOptions(t, srv))
+	require.Error(t, err, "the link to another host should be rejected")
+	assert.Contains(t, err.Error(), "refusing to follow the link")
+	assert.Empty(t, otherAuthorization, "the credentials should not be sent to the other host")
+}
+
+func TestRegistryCredentialsFromHelper(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential helper is a shell script")
+	}
+
+	// The helper returns the credentials for registry.example.com only.
+	binDir := t.TempDir()
+	helper := fmt.Sprintf(`#!/bin/sh
+[ "$1" = get ] || exit 1
+read host
+[ "$host" = registry.example.com ] || { echo "credentials not found in native keychain"; exit 1; }
+echo '{"ServerURL":"registry.example.com","Username":"%s","Secret":"%s"}'
+`, testRegistryUser, testRegistryPassword)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(binDir, "docker-credential-test"), []byte(helper), 0755), "there must be no error writing the credential helper")
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	testCases := []struct {
+		name, config, host string
+		expected           *ociCredentials
+	}{
+		{"credential helper", `{"credHelpers":{"registry.example.com":"test"}}`, "registry.example.com", &ociCredentials{username: testRegistryUser, password: testRegistryPassword}},
+		{"credential store", `{"credsStore":"test"}`, "registry.example.com", &ociCredentials{username: testRegistryUser, password: testRegistryPassword}},
+		{"unknown host", `{"credsStore":"test"}`, "other.example.com", nil},
+		{"missing helper", `{"credHelpers":{"registry.example.com":"missing"}}`, "registry.example.com", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			registryConfig := filepath.Join(t.TempDir(), "registry.json")
+			require.NoError(t, ioutil.WriteFile(registryConfig, []byte(tc.config), 0644), "there must be no error writing the registry config")
+			assert.Equal(t, tc.expected, registryCredentials(context.Background(), registryConfig, tc.host))
+		})
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:charts/a:pull,push"`)
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:charts/a:pull,push",
+	}, params)
+
+	scheme, params = parseChallenge(`Basic realm=registry`)
+	assert.Equal(t, "Basic", scheme)
+	assert.Equal(t, map[string]string{"realm": "registry"}, params)
+}
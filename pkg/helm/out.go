@@ -20,95 +20,155 @@
 package helm
 
 import (
-	"bytes"
-	"encoding/json"
-	"os"
-	"path"
+	"io/ioutil"
 	"path/filepath"
+	"sort"
 
-	"gopkg.in/yaml.v3"
-
-    log "github.com/sirupsen/logrus"
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
 )
 
-// Requirements is a list of requirements for a chart.
-//
-// Requirements are charts upon which this chart depends. This expresses
-// developer intent.
-type Requirements struct {
-	Dependencies []*chart.Dependency `json:"dependencies,flow,inline"`
-	test int
+// ChartWriter collects changes to the files of a chart and writes them all at once.
+// Either all changes are applied or, if writing one of the files fails, none of them.
+type ChartWriter struct {
+	chartPath string
+	chart     *chart.Chart
+	docs      map[string]*yamlDocument
+	tx        *fileTransaction
+	logger    Logger
 }
 
-func toYamlWithIndent(in interface{}, indent int) ([]byte, error) {
-	// Unfortunately chartutil.Requirements, charts.Chart structs only have the JSON anchors, but not the YAML ones.
-	// So we have to take the JSON detour.
-	log.Debug("Converting updated requirements into yaml")
-	jsonData, err := json.Marshal(in)
-	if err != nil {
-		return nil, err
-	}
+// NewChartWriter returns a new ChartWriter for the chart in the given path or an error.
+func NewChartWriter(chartPath string) (*ChartWriter, error) {
+	return newChartWriter(chartPath, log.StandardLogger())
+}
 
-	var jsonObj interface{}
-	if err := yaml.Unmarshal(jsonData, &jsonObj); err != nil {
+func newChartWriter(chartPath string, logger Logger) (*ChartWriter, error) {
+	c, err := loader.Load(chartPath)
+	if err != nil {
 		return nil, err
 	}
 
-	var buf bytes.Buffer
-	enc := yaml.NewEncoder(&buf)
-	defer enc.Close()
-
-	enc.SetIndent(indent)
-	err = enc.Encode(jsonObj)
-	return buf.Bytes(), err
+	return &ChartWriter{
+		chartPath: chartPath,
+		chart:     c,
+		docs:      map[string]*yamlDocument{},
+		tx:        &fileTransaction{},
+		logger:    logger,
+	}, nil
 }
 
-func writeRequirements(chartPath string, reqs []*chart.Dependency, indent int) error {
-
-
-	data, err := toYamlWithIndent(&Requirements{Dependencies:   reqs,}, indent)
+// IncrementChartVersion increments the version of the chart.
+func (w *ChartWriter) IncrementChartVersion(incType IncType) error {
+	chartVersion, err := getChartVersion(w.chart)
 	if err != nil {
 		return err
 	}
 
-	absPath, err := filepath.Abs(path.Join(chartPath, requirementsName))
+	var newVersion semver.Version
+	switch incType {
+	case IncTypes.Major:
+		newVersion = chartVersion.IncMajor()
+	case IncTypes.Minor:
+		newVersion = chartVersion.IncMinor()
+	default:
+		newVersion = chartVersion.IncPatch()
+	}
+
+	doc, err := w.document(chartMetadataName)
 	if err != nil {
 		return err
 	}
 
-	f, err := os.OpenFile(absPath, os.O_RDWR, 0644)
+	if err := doc.SetChartVersion(newVersion.String()); err != nil {
+		return errors.Wrapf(err, "failed to update %s", chartMetadataName)
+	}
+	w.chart.Metadata.Version = newVersion.String()
+	return nil
+}
+
+// UpdateDependencies updates the given dependencies to their latest version using the given strategy.
+func (w *ChartWriter) UpdateDependencies(reqsToUpdate []*Result, strategy UpdateStrategy) error {
+	fileName := dependenciesFileName(w.chart)
+	doc, err := w.document(fileName)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	if err := f.Truncate(0); err != nil {
-		return err
+	for _, dep := range reqsToUpdate {
+		// Results might only be listed because they are deprecated.
+		if !dep.IsOutdated() {
+			continue
+		}
+
+		newVersion, err := strategy.apply(dep.Version, dep.LatestVersion)
+		if err != nil {
+			return errors.Wrapf(err, "failed to update dependency %s", dep.Name)
+		}
+
+		w.logger.Debugf("Updating dependency %s from %s to %s", dep.Name, dep.Version, newVersion)
+		if err := doc.SetDependencyVersion(dep.Name, dep.Alias, newVersion); err != nil {
+			return errors.Wrapf(err, "failed to update %s", fileName)
+		}
+
+		// The latest version was found in the preferred repository.
+		if dep.Policy != nil && dep.Policy.Repository != "" {
+			if err := doc.SetDependencyRepository(dep.Name, dep.Alias, dep.Policy.Repository); err != nil {
+				return errors.Wrapf(err, "failed to update %s", fileName)
+			}
+		}
+	}
+	return nil
+}
+
+// Commit writes all changed files of the chart.
+func (w *ChartWriter) Commit() error {
+	names := make([]string, 0, len(w.docs))
+	for name := range w.docs {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	_, err = f.Write(data)
-	return err
+	for _, name := range names {
+		w.tx.Stage(filepath.Join(w.chartPath, name), w.docs[name].Bytes())
+	}
+	if err := w.tx.Commit(); err != nil {
+		if _, ok := err.(*RollbackError); ok {
+			return errors.Wrapf(err, "failed to write chart %s, some files were changed", w.chartPath)
+		}
+		return errors.Wrapf(err, "failed to write chart %s, no changes were applied", w.chartPath)
+	}
+	return nil
 }
 
-func writeChartMetadata(chartPath string, c *chart.Metadata) error {
-	data, err := toYamlWithIndent(c, 0)
-	if err != nil {
-		return err
+// document returns the document for the given file of the chart including all previous changes.
+func (w *ChartWriter) document(fileName string) (*yamlDocument, error) {
+	if doc, ok := w.docs[fileName]; ok {
+		return doc, nil
 	}
 
-	absPath, err := filepath.Abs(path.Join(chartPath, chartMetadataName))
+	data, err := ioutil.ReadFile(filepath.Join(w.chartPath, fileName))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	f, err := os.OpenFile(absPath, os.O_RDWR, 0644)
+	doc, err := newYAMLDocument(data)
 	if err != nil {
-		return err
+		return nil, errors.Wrapf(err, "failed to parse %s", fileName)
 	}
-	defer f.Close()
+	w.docs[fileName] = doc
+	return doc, nil
+}
 
-	_, err = f.WriteAt(data, 0)
-	return err
+// dependenciesFileName returns the name of the file declaring the dependencies of the given chart.
+// Charts with apiVersion v2 declare their dependencies in the Chart.yaml, v1 charts use the requirements.yaml.
+func dependenciesFileName(c *chart.Chart) string {
+	if c.Metadata.APIVersion == chart.APIVersionV2 {
+		return chartMetadataName
+	}
+	return requirementsName
 }
@@ -0,0 +1,42 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateDependenciesWithPreferredRepository(t *testing.T) {
+	chartPath := copyFixtureChart(t, "chart-v2")
+
+	r := newOutdatedResult("testdependency", "0.0.1", "0.3.2")
+	r.Policy = &Policy{Repository: "https://charts.evil.corp"}
+	require.NoError(t, UpdateDependencies(chartPath, []*Result{r}, 4), "there should be no error updating the dependencies")
+
+	data, err := ioutil.ReadFile(filepath.Join(chartPath, chartMetadataName))
+	require.NoError(t, err, "there must be no error reading the Chart.yaml")
+	assert.Contains(t, string(data), "repository: https://charts.evil.corp\n    version: 0.3.2", "the preferred repository should be written")
+	assert.Contains(t, string(data), "repository: https://repo.evil.corp\n    version: 0.0.2", "other dependencies should not be changed")
+}
@@ -0,0 +1,257 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// OutputFormat is one of OutputFormats.
+type OutputFormat string
+
+// OutputFormats enumerates the available OutputFormat.
+var OutputFormats = struct {
+	// Table is a text table for humans.
+	Table OutputFormat
+	JSON  OutputFormat
+	YAML  OutputFormat
+	// SARIF is a SARIF 2.1.0 log for code scanning tools.
+	SARIF OutputFormat
+	// JUnit is a JUnit XML report for CI test dashboards.
+	JUnit OutputFormat
+	// Markdown is a report for the bodies of pull requests and issues.
+	Markdown OutputFormat
+	// Template renders the results using OutputOptions.Template .
+	Template OutputFormat
+}{
+	"table",
+	"json",
+	"yaml",
+	"sarif",
+	"junit",
+	"markdown",
+	"template",
+}
+
+// ParseOutputFormat returns the OutputFormat with the given name or an error.
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	switch f := OutputFormat(normalizeString(name)); f {
+	case OutputFormats.Table, OutputFormats.JSON, OutputFormats.YAML, OutputFormats.SARIF, OutputFormats.JUnit, OutputFormats.Markdown, OutputFormats.Template:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid output format %q, must be one of %s, %s, %s, %s, %s, %s, %s", name, OutputFormats.Table, OutputFormats.JSON, OutputFormats.YAML, OutputFormats.SARIF, OutputFormats.JUnit, OutputFormats.Markdown, OutputFormats.Template)
+}
+
+// OutputOptions control how results are written.
+type OutputOptions struct {
+	// Title is the line above the table of the table and Markdown output.
+	Title string
+	// MaxColumnWidth limits the width of the columns of the table. 0 means unlimited.
+	MaxColumnWidth uint
+	// FailThreshold is the change to the latest version from which an outdated dependency is a failed JUnit test case.
+	// Defaults to IncTypes.Patch, so every outdated dependency fails.
+	FailThreshold IncType
+	// Template is required for the template output.
+	Template *Template
+}
+
+// ChartOutput is the structured output of the results of a chart.
+type ChartOutput struct {
+	Chart        string              `json:"chart"`
+	ChartPath    string              `json:"chartPath"`
+	Dependencies []*DependencyOutput `json:"dependencies"`
+}
+
+// DependencyOutput is the structured output of a Result.
+type DependencyOutput struct {
+	Name       string `json:"name"`
+	Alias      string `json:"alias,omitempty"`
+	Repository string `json:"repository"`
+	// Version is the version or constraint declared by the chart.
+	Version string `json:"version"`
+	// CurrentVersion is the version in use, which is the latest one satisfying the constraint if one is declared.
+	CurrentVersion          string `json:"currentVersion,omitempty"`
+	LatestSatisfyingVersion string `json:"latestSatisfyingVersion,omitempty"`
+	LatestVersion           string `json:"latestVersion,omitempty"`
+	// Bump is the change from the current to the latest version. It is empty if the latest version is unknown.
+	Bump        IncType `json:"bump,omitempty"`
+	Status      Status  `json:"status"`
+	Error       string  `json:"error,omitempty"`
+	Deprecation string  `json:"deprecation,omitempty"`
+	// Cooldown describes a newer version which is not proposed yet as it was released recently.
+	Cooldown string `json:"cooldown,omitempty"`
+}
+
+// NewChartOutput returns the structured output of the results of the chart in the given path.
+func NewChartOutput(chartPath string, results []*Result) (*ChartOutput, error) {
+	chartName, err := GetChartName(chartPath)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ChartOutput{
+		Chart:        chartName,
+		ChartPath:    chartPath,
+		Dependencies: []*DependencyOutput{},
+	}
+	for _, r := range results {
+		d := &DependencyOutput{
+			Name:                    r.Name,
+			Alias:                   r.Alias,
+			Repository:              r.Repository,
+			Version:                 r.Version,
+			CurrentVersion:          versionString(r.CurrentVersion),
+			LatestSatisfyingVersion: versionString(r.LatestSatisfyingVersion),
+			LatestVersion:           versionString(r.LatestVersion),
+			Status:                  r.Status,
+		}
+		if r.LatestVersion != nil {
+			d.Bump = GetIncType(r.CurrentVersion, r.LatestVersion)
+		}
+		if r.Err != nil {
+			d.Error = r.Err.Error()
+		}
+		if r.Deprecation != nil {
+			d.Deprecation = r.Deprecation.String()
+		}
+		if r.Cooldown != nil {
+			d.Cooldown = r.Cooldown.String()
+		}
+		res.Dependencies = append(res.Dependencies, d)
+	}
+	return res, nil
+}
+
+// WriteOutput writes the results of the chart in the given path in the format.
+func WriteOutput(w io.Writer, format OutputFormat, chartPath string, results []*Result, options OutputOptions) error {
+	switch format {
+	case OutputFormats.Table:
+		_, err := fmt.Fprintln(w, formatTable(results, options))
+		return err
+	case OutputFormats.SARIF:
+		return writeSARIF(w, chartPath, results)
+	case OutputFormats.JUnit:
+		return writeJUnit(w, chartPath, results, options.FailThreshold)
+	case OutputFormats.Markdown:
+		return writeMarkdown(w, chartPath, results, options)
+	case OutputFormats.Template:
+		if options.Template == nil {
+			return errors.New("no template given")
+		}
+		return options.Template.Execute(w, chartPath, results)
+	}
+
+	out, err := NewChartOutput(chartPath, results)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch format {
+	case OutputFormats.JSON:
+		data, err = json.MarshalIndent(out, "", "  ")
+		data = append(data, '\n')
+	case OutputFormats.YAML:
+		data, err = yaml.Marshal(out)
+	default:
+		return fmt.Errorf("invalid output format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// formatTable returns the results as a text table.
+func formatTable(results []*Result, options OutputOptions) string {
+	if len(results) == 0 {
+		return "All charts up to date."
+	}
+	table := uitable.New()
+	if options.MaxColumnWidth > 0 {
+		table.MaxColWidth = options.MaxColumnWidth
+	}
+	table.AddRow("ALIAS", "VERSION", "LATEST_SATISFYING_VERSION", "LATEST_VERSION", "STATUS", "PRERELEASES", "REPOSITORY", "RULE")
+	for _, r := range results {
+		name := r.Alias
+		if name == "" {
+			name = r.Name
+		}
+		var (
+			prereleases PrereleasePolicy
+			rule        = "-"
+		)
+		if r.Policy != nil {
+			prereleases = r.Policy.Prereleases
+			if r.Policy.Rule != "" {
+				rule = r.Policy.Rule
+			}
+		}
+		table.AddRow(name, r.Version, formatVersion(r.LatestSatisfyingVersion), formatVersion(r.LatestVersion), formatStatus(r), prereleases, r.Repository, rule)
+	}
+	// The title is not a row, so it is neither cut by the max column width nor widens the first column.
+	if options.Title != "" {
+		return options.Title + "\n" + table.String()
+	}
+	return table.String()
+}
+
+// formatStatus returns the status of the result for tables.
+func formatStatus(r *Result) string {
+	var status []string
+	if r.Failed() || r.Status == Statuses.Unknown {
+		status = append(status, string(r.Status)+" ("+r.Err.Error()+")")
+	}
+	if r.IsOutdated() {
+		status = append(status, "outdated")
+	}
+	if r.Deprecation != nil {
+		status = append(status, "deprecated: "+r.Deprecation.String())
+	}
+	if r.Cooldown != nil {
+		status = append(status, r.Cooldown.String())
+	}
+	return strings.Join(status, ", ")
+}
+
+// formatVersion returns the version or a dash if there is none.
+func formatVersion(v *semver.Version) string {
+	if v == nil {
+		return "-"
+	}
+	return v.String()
+}
+
+// versionString returns the version or an empty string if there is none.
+func versionString(v *semver.Version) string {
+	if v == nil {
+		return ""
+	}
+	return v.String()
+}
@@ -0,0 +1,199 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "update the golden files in fixtures/output")
+
+// assertGolden compares the data with the golden file in fixtures/output. The file is written if -update-golden is set.
+func assertGolden(t *testing.T, name string, data []byte) {
+	goldenFile := filepath.Join("fixtures", "output", name)
+	if *updateGolden {
+		require.NoError(t, ioutil.WriteFile(goldenFile, data, 0644), "there must be no error writing the golden file")
+	}
+
+	expected, err := ioutil.ReadFile(goldenFile)
+	require.NoError(t, err, "there must be no error reading the golden file")
+	assert.Equal(t, string(expected), string(data), "the output should match the golden file %s", goldenFile)
+}
+
+// newTestOutputResults returns results of the fixture chart chart-v2 covering every kind of output.
+func newTestOutputResults() (string, []*Result) {
+	outdated := newOutdatedResult("testdependency", "0.0.1", "2.1.0")
+	outdated.Alias = "test"
+	outdated.LatestSatisfyingVersion = semver.MustParse("0.0.1")
+	outdated.Status = Statuses.Outdated
+	outdated.Policy = &Policy{Prereleases: PrereleasePolicies.Never, Rule: ".helm-outdated.yaml:3"}
+	outdated.Position = &Position{File: "Chart.yaml", Line: 8, Column: 14}
+	outdated.LatestChart = &chart.Metadata{
+		Name:        "testdependency",
+		Version:     "2.1.0",
+		Description: "The test dependency",
+		Home:        "https://testdependency.evil.corp",
+		Sources:     []string{"https://github.com/evil-corp/testdependency"},
+	}
+
+	constraint, _ := semver.NewConstraint("~0.9.0 || ~1.0.0")
+	deprecated := newResult(&chart.Dependency{Name: "deprecated", Version: "~0.9.0 || ~1.0.0", Repository: testRepository},
+		constraint, semver.MustParse("1.0.2"), semver.MustParse("1.0.2"))
+	deprecated.Status = Statuses.OK
+	deprecated.Deprecation = &Deprecation{Reason: "chart is deprecated", Replacement: "https://charts.example.com"}
+
+	failed := newFailedResult(&chart.Dependency{Name: "testdependency1", Version: "0.0.2", Repository: "https://unreachable.example.com"},
+		nil, Statuses.RepoUnreachable, errors.New("failed to update the repository index: connection refused"))
+
+	return filepath.Join("fixtures", "chart-v2"), []*Result{outdated, deprecated, failed}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	f, err := ParseOutputFormat("JSON")
+	assert.NoError(t, err, "there should be no error parsing a known format")
+	assert.Equal(t, OutputFormats.JSON, f)
+
+	_, err = ParseOutputFormat("xml")
+	assert.Error(t, err, "there should be an error parsing an unknown format")
+}
+
+func TestWriteOutput(t *testing.T) {
+	chartPath, results := newTestOutputResults()
+	testCases := []struct {
+		format     OutputFormat
+		goldenFile string
+	}{
+		{format: OutputFormats.Table, goldenFile: "results.txt"},
+		{format: OutputFormats.JSON, goldenFile: "results.json"},
+		{format: OutputFormats.YAML, goldenFile: "results.yaml"},
+		{format: OutputFormats.SARIF, goldenFile: "results.sarif"},
+		{format: OutputFormats.JUnit, goldenFile: "results.xml"},
+		{format: OutputFormats.Markdown, goldenFile: "results.md"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteOutput(&buf, tc.format, chartPath, results, OutputOptions{Title: "The following dependencies are outdated:"})
+			require.NoError(t, err, "there should be no error writing the output")
+			assertGolden(t, tc.goldenFile, buf.Bytes())
+		})
+	}
+}
+
+func TestWriteOutputTableTitle(t *testing.T) {
+	chartPath, results := newTestOutputResults()
+	title := "The following dependencies are outdated, deprecated or could not be checked:"
+
+	var buf bytes.Buffer
+	err := WriteOutput(&buf, OutputFormats.Table, chartPath, results, OutputOptions{Title: title, MaxColumnWidth: 60})
+	require.NoError(t, err, "there should be no error writing the output")
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, title, lines[0], "the title should not be cut by the max column width")
+	assert.True(t, strings.HasPrefix(lines[1], "ALIAS "), "the header should follow the title")
+}
+
+func TestWriteSARIFWithoutPosition(t *testing.T) {
+	tests := []struct {
+		chart, expectedURI string
+	}{
+		{"chart-v1", "fixtures/chart-v1/requirements.yaml"},
+		{"chart-v2", "fixtures/chart-v2/Chart.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.chart, func(t *testing.T) {
+			r := newOutdatedResult("testdependency", "1.2.0", "2.0.0")
+			r.Position = nil
+
+			var buf bytes.Buffer
+			require.NoError(t, writeSARIF(&buf, filepath.Join("fixtures", tt.chart), []*Result{r}), "there should be no error writing the output")
+			assert.Contains(t, buf.String(), `"uri": "`+tt.expectedURI+`"`, "the location should be the file declaring the dependencies")
+		})
+	}
+}
+
+func TestSarifURI(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err, "there must be no error getting the working directory")
+
+	assert.Equal(t, "..values/Chart.yaml", sarifURI(filepath.Join(wd, "..values", "Chart.yaml")), "a directory named ..values should be inside the working directory")
+	assert.Equal(t, "fixtures/chart-v2/Chart.yaml", sarifURI(filepath.Join("fixtures", "chart-v2", "Chart.yaml")))
+	outside := filepath.Join(filepath.Dir(wd), "Chart.yaml")
+	assert.Equal(t, "file://"+filepath.ToSlash(outside), sarifURI(outside), "a path outside of the working directory should be absolute")
+}
+
+func TestWriteOutputWithCooldown(t *testing.T) {
+	chartPath, _ := newTestOutputResults()
+	r := newOutdatedResult("testdependency", "1.2.0", "1.2.0")
+	r.Status = Statuses.OK
+	r.Cooldown = &Cooldown{Version: semver.MustParse("1.4.0"), Until: time.Date(2020, 6, 4, 0, 0, 0, 0, time.UTC)}
+
+	testCases := []struct {
+		format   OutputFormat
+		expected string
+	}{
+		{format: OutputFormats.Table, expected: "newer version 1.4.0 exists but is in cooldown until 2020-06-04T00:00:00Z"},
+		{format: OutputFormats.JSON, expected: `"cooldown": "newer version 1.4.0 exists but is in cooldown until 2020-06-04T00:00:00Z"`},
+		{format: OutputFormats.YAML, expected: "cooldown: newer version 1.4.0 exists but is in cooldown until 2020-06-04T00:00:00Z"},
+		{format: OutputFormats.Markdown, expected: "- Status: newer version 1.4.0 exists but is in cooldown until 2020-06-04T00:00:00Z"},
+		{format: OutputFormats.JUnit, expected: "cooldown: newer version 1.4.0 exists but is in cooldown until 2020-06-04T00:00:00Z"},
+	}
+
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		err := WriteOutput(&buf, tc.format, chartPath, []*Result{r}, OutputOptions{})
+		require.NoError(t, err, "there should be no error writing the output")
+		assert.Contains(t, buf.String(), tc.expected, "the %s output should show the cooldown", tc.format)
+		assert.NotContains(t, buf.String(), "All charts up to date", "the %s output should list the dependency", tc.format)
+	}
+}
+
+func TestWriteOutputWithoutResults(t *testing.T) {
+	chartPath, _ := newTestOutputResults()
+	testCases := []struct {
+		format   OutputFormat
+		expected string
+	}{
+		{format: OutputFormats.Table, expected: "All charts up to date.\n"},
+		{format: OutputFormats.JSON, expected: "{\n  \"chart\": \"chart-v2\",\n  \"chartPath\": \"fixtures/chart-v2\",\n  \"dependencies\": []\n}\n"},
+		{format: OutputFormats.YAML, expected: "chart: chart-v2\nchartPath: fixtures/chart-v2\ndependencies: []\n"},
+	}
+
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		err := WriteOutput(&buf, tc.format, chartPath, nil, OutputOptions{})
+		require.NoError(t, err, "there should be no error writing the output")
+		assert.Equal(t, tc.expected, buf.String(), "wrong %s output without results", tc.format)
+	}
+}
@@ -0,0 +1,174 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// now returns the current time. Replaced in tests.
+var now = time.Now
+
+// PrereleasePolicy is one of PrereleasePolicies.
+type PrereleasePolicy string
+
+// PrereleasePolicies enumerates available PrereleasePolicy.
+var PrereleasePolicies = struct {
+	// Never ignores pre-release versions.
+	Never PrereleasePolicy
+	// IfCurrentIsPrerelease considers pre-release versions only for dependencies already using one.
+	IfCurrentIsPrerelease PrereleasePolicy
+	// Always considers pre-release versions.
+	Always PrereleasePolicy
+}{
+	"never",
+	"if-current-is-prerelease",
+	"always",
+}
+
+// ParsePrereleasePolicy returns the PrereleasePolicy with the given name or an error.
+func ParsePrereleasePolicy(name string) (PrereleasePolicy, error) {
+	switch p := PrereleasePolicy(normalizeString(name)); p {
+	case PrereleasePolicies.Never, PrereleasePolicies.IfCurrentIsPrerelease, PrereleasePolicies.Always:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid pre-release policy %q, must be one of %s, %s, %s",
+		name, PrereleasePolicies.Never, PrereleasePolicies.IfCurrentIsPrerelease, PrereleasePolicies.Always)
+}
+
+// Policy controls which versions of a dependency are considered when looking for the latest version.
+type Policy struct {
+	// MaxBump is the highest change of the version that is considered. For example with IncTypes.Minor the latest
+	// minor or patch release of the current major version is proposed instead of a new major version.
+	// Defaults to IncTypes.Major.
+	MaxBump IncType
+	// Prereleases controls whether pre-release versions are considered.
+	// Defaults to PrereleasePolicies.IfCurrentIsPrerelease.
+	Prereleases PrereleasePolicy
+	// Ignore excludes the dependency entirely.
+	Ignore bool
+	// IgnoreVersions are versions or constraints that are never proposed.
+	IgnoreVersions []*semver.Constraints
+	// MinReleaseAge is the minimum time since a version was published before it is proposed.
+	MinReleaseAge time.Duration
+	// Repository is looked up instead of the repository declared by the dependency.
+	Repository string
+	// Rule describes where the policy was declared, e.g. .helm-outdated.yaml:12 . For the default policy, these are the
+	// declarations of its settings. For the policy of a dependency, these are the rules which were applied.
+	Rule string
+	// Dependencies overrides the policy for single dependencies identified by their name or alias.
+	Dependencies map[string]*Policy
+}
+
+// forDependency returns the policy for the given dependency.
+// Settings of a policy declared for the alias take precedence over the ones declared for the name.
+func (p *Policy) forDependency(dep *chart.Dependency) *Policy {
+	res := &Policy{}
+	if p != nil {
+		res.merge(p)
+		res.Rule = p.Rule
+		for _, key := range []string{dep.Name, dep.Alias} {
+			if o, ok := p.Dependencies[key]; ok && key != "" {
+				res.merge(o)
+				res.Rule = joinNonEmpty(", ", res.Rule, o.Rule)
+			}
+		}
+	}
+
+	if res.MaxBump == "" {
+		res.MaxBump = IncTypes.Major
+	}
+	if res.Prereleases == "" {
+		res.Prereleases = PrereleasePolicies.IfCurrentIsPrerelease
+	}
+	return res
+}
+
+// merge overrides the settings of the policy with the ones set in the given policy.
+func (p *Policy) merge(o *Policy) {
+	if o.MaxBump != "" {
+		p.MaxBump = o.MaxBump
+	}
+	if o.Prereleases != "" {
+		p.Prereleases = o.Prereleases
+	}
+	if o.MinReleaseAge != 0 {
+		p.MinReleaseAge = o.MinReleaseAge
+	}
+	if o.Repository != "" {
+		p.Repository = o.Repository
+	}
+	p.Ignore = p.Ignore || o.Ignore
+	p.IgnoreVersions = append(p.IgnoreVersions, o.IgnoreVersions...)
+}
+
+// isIgnored checks whether the policy excludes the given version.
+func (p *Policy) isIgnored(version *semver.Version) bool {
+	if p == nil {
+		return false
+	}
+	for _, c := range p.IgnoreVersions {
+		if c.Check(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// cooldownUntil returns the time until a version published at the given time is in cooldown and whether this is
+// still the case. Versions without a publication date are never in cooldown.
+func (p *Policy) cooldownUntil(created time.Time) (time.Time, bool) {
+	if p == nil || p.MinReleaseAge <= 0 || created.IsZero() {
+		return time.Time{}, false
+	}
+	until := created.Add(p.MinReleaseAge)
+	return until, now().Before(until)
+}
+
+// allows checks whether the policy allows updating from the current to the given version.
+func (p *Policy) allows(currentVersion, version *semver.Version) bool {
+	if p == nil || p.MaxBump == "" || currentVersion == nil {
+		return true
+	}
+	return !p.MaxBump.IsGreater(GetIncType(currentVersion, version))
+}
+
+// allowsPrerelease checks whether the policy allows pre-release versions for a dependency declaring the given
+// version or constraint.
+func (p *Policy) allowsPrerelease(declaredVersion string) bool {
+	prereleases := PrereleasePolicies.IfCurrentIsPrerelease
+	if p != nil && p.Prereleases != "" {
+		prereleases = p.Prereleases
+	}
+
+	switch prereleases {
+	case PrereleasePolicies.Always:
+		return true
+	case PrereleasePolicies.Never:
+		return false
+	}
+
+	v := getConstraintVersion(declaredVersion)
+	return v != nil && v.Prerelease() != ""
+}
@@ -0,0 +1,150 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestPrereleasePolicies(t *testing.T) {
+	tests := []struct {
+		version               string
+		prereleases           PrereleasePolicy
+		maxBump               IncType
+		expectedLatestVersion string
+	}{
+		{"2.1.0", PrereleasePolicies.Never, "", "2.1.0"},
+		{"2.1.0", PrereleasePolicies.IfCurrentIsPrerelease, "", "2.1.0"},
+		{"2.1.0", PrereleasePolicies.Always, "", "3.0.0-rc.1"},
+		{"2.1.0", PrereleasePolicies.Always, IncTypes.Minor, "2.2.0-rc.2"},
+		{"2.2.0-rc.1", PrereleasePolicies.Never, "", "2.1.0"},
+		{"2.2.0-rc.1", PrereleasePolicies.IfCurrentIsPrerelease, IncTypes.Minor, "2.2.0-rc.2"},
+		{"~2.2.0-rc.1", PrereleasePolicies.IfCurrentIsPrerelease, IncTypes.Minor, "2.2.0-rc.2"},
+		{"2.2.0-rc.1", PrereleasePolicies.IfCurrentIsPrerelease, "", "3.0.0-rc.1"},
+		{"2.2.0-rc.1", "", "", "3.0.0-rc.1"},
+	}
+
+	settings := newTestSettings(t)
+	for _, tt := range tests {
+		t.Run(tt.version+"-"+string(tt.prereleases)+"-"+string(tt.maxBump), func(t *testing.T) {
+			dep := &chart.Dependency{Name: "testdependency", Version: tt.version, Repository: testRepository}
+			constraint, err := semver.NewConstraint(dep.Version)
+			require.NoError(t, err, "there must be no error parsing the constraint")
+
+			policy := (&Policy{Prereleases: tt.prereleases, MaxBump: tt.maxBump}).forDependency(dep)
+			_, latestVersion, _, err := findLatestVersionOfDependency(context.Background(), dep, mustLoadChartVersions(t, dep, settings), constraint, policy)
+			require.NoError(t, err, "there should be no error finding the latest version")
+			assert.Equal(t, tt.expectedLatestVersion, latestVersion.String())
+		})
+	}
+}
+
+func TestPolicyForDependency(t *testing.T) {
+	policy := &Policy{
+		MaxBump:     IncTypes.Minor,
+		Prereleases: PrereleasePolicies.Never,
+		Dependencies: map[string]*Policy{
+			"testdependency": {Prereleases: PrereleasePolicies.Always},
+			"aliased":        {MaxBump: IncTypes.Patch},
+		},
+	}
+
+	p := policy.forDependency(&chart.Dependency{Name: "testdependency"})
+	assert.Equal(t, PrereleasePolicies.Always, p.Prereleases, "the pre-release policy of the dependency should take precedence")
+	assert.Equal(t, IncTypes.Minor, p.MaxBump, "unset settings should be inherited")
+
+	p = policy.forDependency(&chart.Dependency{Name: "testdependency", Alias: "aliased"})
+	assert.Equal(t, PrereleasePolicies.Always, p.Prereleases, "the settings for the name should apply to aliased dependencies")
+	assert.Equal(t, IncTypes.Patch, p.MaxBump, "the settings for the alias should take precedence")
+
+	p = (*Policy)(nil).forDependency(&chart.Dependency{Name: "other"})
+	assert.Equal(t, PrereleasePolicies.IfCurrentIsPrerelease, p.Prereleases, "the default pre-release policy should be used")
+	assert.Equal(t, IncTypes.Major, p.MaxBump, "the default max bump should be used")
+}
+
+func TestParsePrereleasePolicy(t *testing.T) {
+	p, err := ParsePrereleasePolicy("Always")
+	assert.NoError(t, err, "the policy should be parsed case insensitive")
+	assert.Equal(t, PrereleasePolicies.Always, p)
+
+	_, err = ParsePrereleasePolicy("sometimes")
+	assert.Error(t, err, "an unknown policy should be rejected")
+}
+
+func TestMinReleaseAge(t *testing.T) {
+	defer func(n func() time.Time) { now = n }(now)
+	now = func() time.Time { return time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		version               string
+		minReleaseAge         time.Duration
+		expectedLatestVersion string
+		expectedCooldown      string
+		expectedCooldownUntil time.Time
+	}{
+		{"1.2.0", 0, "2.1.0", "", time.Time{}},
+		{"1.2.0", 72 * time.Hour, "2.0.0", "2.1.0", time.Date(2020, 12, 3, 0, 0, 0, 0, time.UTC)},
+		{"1.2.0", 24 * time.Hour, "2.1.0", "", time.Time{}},
+		{"2.1.0", 72 * time.Hour, "2.1.0", "", time.Time{}},
+		{"2.2.0-rc.1", 72 * time.Hour, "2.2.0-rc.1", "3.0.0-rc.1", time.Date(2020, 12, 3, 12, 0, 0, 0, time.UTC)},
+	}
+
+	settings := newTestSettings(t)
+	for _, tt := range tests {
+		t.Run(tt.version+"-"+tt.minReleaseAge.String(), func(t *testing.T) {
+			dep := &chart.Dependency{Name: "testdependency", Version: tt.version, Repository: testRepository}
+			constraint, err := semver.NewConstraint(dep.Version)
+			require.NoError(t, err, "there must be no error parsing the constraint")
+
+			policy := (&Policy{MinReleaseAge: tt.minReleaseAge}).forDependency(dep)
+			_, latestVersion, cooldown, err := findLatestVersionOfDependency(context.Background(), dep, mustLoadChartVersions(t, dep, settings), constraint, policy)
+			require.NoError(t, err, "there should be no error finding the latest version")
+			assert.Equal(t, tt.expectedLatestVersion, latestVersion.String())
+
+			if tt.expectedCooldown == "" {
+				assert.Nil(t, cooldown, "there should be no version in cooldown")
+				return
+			}
+			require.NotNil(t, cooldown, "there should be a version in cooldown")
+			assert.Equal(t, tt.expectedCooldown, cooldown.Version.String())
+			assert.True(t, tt.expectedCooldownUntil.Equal(cooldown.Until), "the cooldown should end at %s but ends at %s", tt.expectedCooldownUntil, cooldown.Until)
+		})
+	}
+}
+
+func TestMinReleaseAgeAllVersionsInCooldown(t *testing.T) {
+	defer func(n func() time.Time) { now = n }(now)
+	now = func() time.Time { return time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC) }
+
+	dep := &chart.Dependency{Name: "testdependency", Version: "1.0.0", Repository: testRepository}
+	constraint, err := semver.NewConstraint(dep.Version)
+	require.NoError(t, err, "there must be no error parsing the constraint")
+
+	_, _, _, err = findLatestVersionOfDependency(context.Background(), dep, mustLoadChartVersions(t, dep, newTestSettings(t)), constraint, &Policy{MinReleaseAge: 72 * time.Hour, MaxBump: IncTypes.Minor})
+	require.Error(t, err, "there should be an error if all versions are in cooldown")
+	assert.Contains(t, err.Error(), "newer version 1.4.0 exists but is in cooldown until 2020-06-04T00:00:00Z")
+}
@@ -0,0 +1,182 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// ErrNoCachedIndex is reported for dependencies whose repository index is not cached in offline mode.
+var ErrNoCachedIndex = errors.New("no cached index")
+
+// RepositoryOptions control how repositories are accessed.
+type RepositoryOptions struct {
+	// Credentials are used for repositories which are not configured in the repositories.yaml of Helm.
+	Credentials *RepositoryCredentials
+	// Offline skips all downloads and only uses the indexes found in the repository cache.
+	Offline bool
+	// IndexMaxAge is the time a downloaded index is used without checking the repository for changes.
+	IndexMaxAge time.Duration
+	// PlainHTTP accesses OCI registries via HTTP instead of HTTPS, e.g. local registries used for testing.
+	PlainHTTP bool
+	// Concurrency is the number of repositories updated and dependencies resolved at the same time.
+	// Defaults to 8.
+	Concurrency int
+}
+
+// concurrency returns the configured concurrency or the default.
+func (o *RepositoryOptions) concurrency() int {
+	if o.Concurrency < 1 {
+		return defaultConcurrency
+	}
+	return o.Concurrency
+}
+
+// RepositoryCredentials are the authentication and TLS settings used for repositories which are not configured in
+// the repositories.yaml of Helm.
+type RepositoryCredentials struct {
+	Username string
+	Password string
+	// CertFile and KeyFile identify the client using a certificate.
+	CertFile string
+	KeyFile  string
+	// CAFile is used to verify the certificate of the repository.
+	CAFile                string
+	InsecureSkipTLSVerify bool
+}
+
+// repositories are the repositories configured in the repositories.yaml of Helm.
+type repositories []*repo.Entry
+
+// loadRepositories loads the repositories configured in the given settings.
+// A missing repositories.yaml is treated like an empty one.
+func loadRepositories(ctx context.Context, settings *cli.EnvSettings) (repositories, error) {
+	f, err := repo.LoadFile(settings.RepositoryConfig)
+	if err != nil {
+		if _, statErr := os.Stat(settings.RepositoryConfig); os.IsNotExist(statErr) {
+			loggerFrom(ctx).Debugf("No repositories configured in %s", settings.RepositoryConfig)
+			return nil, nil
+		}
+		return nil, err
+	}
+	return f.Repositories, nil
+}
+
+// isRepositoryAlias checks whether the repository refers to a configured repository by its name like @stable or
+// alias:stable .
+func isRepositoryAlias(repository string) bool {
+	return strings.HasPrefix(repository, "@") || strings.HasPrefix(repository, "alias:")
+}
+
+// aliasName returns the name of the repository referred to by the alias.
+func aliasName(alias string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(alias, "@"), "alias:")
+}
+
+// resolve returns the URL of the repository. Aliases are replaced by the URL of the configured repository,
+// other repositories are returned unchanged.
+func (r repositories) resolve(repository string) (string, error) {
+	if !isRepositoryAlias(repository) {
+		return repository, nil
+	}
+
+	name := aliasName(repository)
+	for _, e := range r {
+		if e.Name == name {
+			return e.URL, nil
+		}
+	}
+	return "", fmt.Errorf("no repository definition for %s, use helm repo add", repository)
+}
+
+// name returns the name of the repository or an empty string if it is not configured.
+// The repository might be an alias or a URL.
+func (r repositories) name(repository string) string {
+	if isRepositoryAlias(repository) {
+		return aliasName(repository)
+	}
+	for _, e := range r {
+		if isSameRepository(e.URL, repository) {
+			return e.Name
+		}
+	}
+	return ""
+}
+
+// entry returns the entry used to fetch the index of the repository with the given URL.
+// The authentication and TLS settings of a configured repository with this URL are used, otherwise the given
+// credentials. Credentials are always passed as only the index is fetched, which is served by the repository itself.
+func (r repositories) entry(ctx context.Context, url string, credentials *RepositoryCredentials) *repo.Entry {
+	res := &repo.Entry{
+		Name: normalizeRepoName(url),
+		URL:  url,
+	}
+
+	for _, e := range r {
+		if isSameRepository(e.URL, url) {
+			loggerFrom(ctx).Debugf("Using the settings of the configured repository %s for %s", e.Name, url)
+			res.Username = e.Username
+			res.Password = e.Password
+			res.CertFile = e.CertFile
+			res.KeyFile = e.KeyFile
+			res.CAFile = e.CAFile
+			res.InsecureSkipTLSverify = e.InsecureSkipTLSverify
+			return res
+		}
+	}
+
+	if credentials != nil {
+		res.Username = credentials.Username
+		res.Password = credentials.Password
+		res.CertFile = credentials.CertFile
+		res.KeyFile = credentials.KeyFile
+		res.CAFile = credentials.CAFile
+		res.InsecureSkipTLSverify = credentials.InsecureSkipTLSVerify
+	}
+	return res
+}
+
+// cachedIndexFile returns the path of the cached index of the repository with the given URL.
+// Indexes downloaded by this plugin are named after the URL, those downloaded by helm repo update after the name of
+// the configured repository.
+func (r repositories) cachedIndexFile(url string, settings *cli.EnvSettings) (string, error) {
+	candidates := []string{normalizeRepoName(url)}
+	if name := r.name(url); name != "" {
+		candidates = append(candidates, name)
+	}
+
+	for _, name := range candidates {
+		p := filepath.Join(settings.RepositoryCache, helmpath.CacheIndexFile(name))
+		if fileExists(p) {
+			return p, nil
+		}
+	}
+	return "", ErrNoCachedIndex
+}
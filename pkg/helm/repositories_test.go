@@ -0,0 +1,324 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/helmpath"
+)
+
+// newTestRepositoriesSettings returns settings with a repositories.yaml configuring the test repository as evil-corp.
+func newTestRepositoriesSettings(t *testing.T) *cli.EnvSettings {
+	settings := newTestSettings(t)
+	settings.RepositoryConfig = filepath.Join(t.TempDir(), "repositories.yaml")
+	require.NoError(t, ioutil.WriteFile(settings.RepositoryConfig, []byte(`apiVersion: ""
+repositories:
+  - name: evil-corp
+    url: https://repo.evil.corp/
+  - name: other
+    url: https://charts.evil.corp
+`), 0644), "there must be no error writing the repositories.yaml")
+	return settings
+}
+
+func TestResolveRepository(t *testing.T) {
+	repos, err := loadRepositories(context.Background(), newTestRepositoriesSettings(t))
+	require.NoError(t, err, "there should be no error loading the repositories")
+
+	for _, alias := range []string{"@evil-corp", "alias:evil-corp"} {
+		url, err := repos.resolve(alias)
+		assert.NoError(t, err, "there should be no error resolving %s", alias)
+		assert.Equal(t, "https://repo.evil.corp/", url)
+	}
+
+	url, err := repos.resolve(testRepository)
+	assert.NoError(t, err, "there should be no error resolving a URL")
+	assert.Equal(t, testRepository, url, "URLs should be returned unchanged")
+
+	_, err = repos.resolve("@unknown")
+	assert.EqualError(t, err, "no repository definition for @unknown, use helm repo add")
+
+	assert.Equal(t, "evil-corp", repos.name(testRepository), "the name should be found by the URL")
+	assert.Equal(t, "evil-corp", repos.name("@evil-corp"), "the name should be found by the alias")
+	assert.Equal(t, "", repos.name("https://unknown.evil.corp"), "unknown repositories have no name")
+}
+
+func TestLoadRepositoriesMissingFile(t *testing.T) {
+	settings := newTestSettings(t)
+	settings.RepositoryConfig = filepath.Join(t.TempDir(), "repositories.yaml")
+
+	repos, err := loadRepositories(context.Background(), settings)
+	assert.NoError(t, err, "a missing repositories.yaml should not be an error")
+	assert.Empty(t, repos)
+}
+
+func TestFilterDependenciesByRepositoryName(t *testing.T) {
+	repos, err := loadRepositories(context.Background(), newTestRepositoriesSettings(t))
+	require.NoError(t, err, "there should be no error loading the repositories")
+
+	deps := []*chart.Dependency{
+		{Name: "a", Repository: testRepository},
+		{Name: "b", Repository: "@other"},
+		{Name: "c", Repository: "https://charts.evil.corp"},
+		{Name: "d", Repository: "https://unknown.evil.corp"},
+	}
+
+	tests := []struct {
+		repositories  []string
+		expectedNames []string
+	}{
+		{[]string{"evil-corp"}, []string{"a"}},
+		{[]string{"other"}, []string{"b", "c"}},
+		{[]string{"charts.evil"}, []string{"c"}},
+		{[]string{"evil.corp"}, []string{"a", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		f := &Filter{Repositories: tt.repositories}
+		var names []string
+		for _, dep := range f.filterDependencies(deps, repos) {
+			names = append(names, dep.Name)
+		}
+		assert.Equal(t, tt.expectedNames, names, "filter %v", tt.repositories)
+	}
+}
+
+// testCertificates are the files of a CA, a server and a client certificate issued by it.
+type testCertificates struct {
+	caFile,
+	serverCertFile,
+	serverKeyFile,
+	clientCertFile,
+	clientKeyFile string
+}
+
+func newTestCertificates(t *testing.T) *testCertificates {
+	dir := t.TempDir()
+
+	writePEM := func(name, typ string, data []byte) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: data}), 0600), "there must be no error writing %s", name)
+		return p
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "there must be no error generating the CA key")
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Evil Corp CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err, "there must be no error creating the CA certificate")
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err, "there must be no error parsing the CA certificate")
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err, "there must be no error generating the %s key", name)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		require.NoError(t, err, "there must be no error creating the %s certificate", name)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err, "there must be no error encoding the %s key", name)
+		return writePEM(name+".pem", "CERTIFICATE", der), writePEM(name+"-key.pem", "EC PRIVATE KEY", keyDER)
+	}
+
+	c := &testCertificates{caFile: writePEM("ca.pem", "CERTIFICATE", caDER)}
+	c.serverCertFile, c.serverKeyFile = issue("server", 2, x509.ExtKeyUsageServerAuth)
+	c.clientCertFile, c.clientKeyFile = issue("client", 3, x509.ExtKeyUsageClientAuth)
+	return c
+}
+
+// newTestChartRepository starts a repository serving the test index which requires basic authentication and a
+// client certificate.
+func newTestChartRepository(t *testing.T, certs *testCertificates) *httptest.Server {
+	index, err := ioutil.ReadFile(filepath.Join("fixtures", "repository", "index.yaml"))
+	require.NoError(t, err, "there must be no error reading the repository index")
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != testRegistryUser || password != testRegistryPassword {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/charts/index.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(index)
+	}))
+
+	serverCert, err := tls.LoadX509KeyPair(certs.serverCertFile, certs.serverKeyFile)
+	require.NoError(t, err, "there must be no error loading the server certificate")
+	caData, err := ioutil.ReadFile(certs.caFile)
+	require.NoError(t, err, "there must be no error reading the CA certificate")
+	clientCAs := x509.NewCertPool()
+	require.True(t, clientCAs.AppendCertsFromPEM(caData), "the CA certificate must be valid")
+
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestParallelRepoUpdateWithCredentials(t *testing.T) {
+	withShortRetryBackoff(t)
+	certs := newTestCertificates(t)
+	srv := newTestChartRepository(t, certs)
+	repoURL := srv.URL + "/charts"
+	deps := []*chart.Dependency{{Name: "testdependency", Version: "1.2.0", Repository: repoURL}}
+
+	configured := repositories{{
+		Name:     "private",
+		URL:      repoURL + "/",
+		Username: testRegistryUser,
+		Password: testRegistryPassword,
+		CertFile: certs.clientCertFile,
+		KeyFile:  certs.clientKeyFile,
+		CAFile:   certs.caFile,
+	}}
+	credentials := &RepositoryCredentials{
+		Username: testRegistryUser,
+		Password: testRegistryPassword,
+		CertFile: certs.clientCertFile,
+		KeyFile:  certs.clientKeyFile,
+		CAFile:   certs.caFile,
+	}
+
+	tests := []struct {
+		name        string
+		configured  repositories
+		credentials *RepositoryCredentials
+		expectIndex bool
+	}{
+		{"configured repository", configured, nil, true},
+		{"credentials", nil, credentials, true},
+		{"configured repository takes precedence", configured, &RepositoryCredentials{Username: "wrong"}, true},
+		{"no credentials", nil, nil, false},
+		{"wrong password", nil, &RepositoryCredentials{Username: testRegistryUser, Password: "wrong", CertFile: certs.clientCertFile, KeyFile: certs.clientKeyFile, CAFile: certs.caFile}, false},
+		{"no client certificate", nil, &RepositoryCredentials{Username: testRegistryUser, Password: testRegistryPassword, CAFile: certs.caFile}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := cli.New()
+			settings.RepositoryCache = t.TempDir()
+
+			failed := failedRepositories(parallelRepoUpdate(context.Background(), deps, tt.configured, &RepositoryOptions{Credentials: tt.credentials}, settings))
+
+			_, err := os.Stat(filepath.Join(settings.RepositoryCache, helmpath.CacheIndexFile(normalizeRepoName(repoURL))))
+			if !tt.expectIndex {
+				assert.True(t, os.IsNotExist(err), "the index should not have been downloaded")
+				assert.Error(t, failed[repoURL], "the failed update should be reported")
+				return
+			}
+			require.NoError(t, err, "the index should have been downloaded")
+			assert.Empty(t, failed, "no update should fail")
+
+			chartVersions, err := loadChartVersions(context.Background(), deps[0], nil, settings, &RepositoryOptions{})
+			require.NoError(t, err, "there should be no error loading the versions")
+			assert.Equal(t, "3.0.0-rc.1", chartVersions[0].Version, "the versions should be read from the downloaded index")
+		})
+	}
+}
+
+func TestListOutdatedDependenciesOffline(t *testing.T) {
+	chartPath := copyFixtureChart(t, "chart-v2")
+	check := func(settings *cli.EnvSettings, filter *Filter) ([]*Result, error) {
+		report, err := NewChecker(Options{Settings: settings, Filter: filter, Repositories: &RepositoryOptions{Offline: true}}).Check(context.Background(), chartPath)
+		if err != nil {
+			return nil, err
+		}
+		return report.Results, nil
+	}
+
+	// The index is cached using the normalized URL of the repository.
+	res, err := check(newTestSettings(t), &Filter{DependencyNames: []string{"testdependency"}})
+	require.NoError(t, err, "there should be no error listing the dependencies")
+	require.Len(t, res, 2, "there should be a result for every dependency")
+	assert.Equal(t, Statuses.Outdated, res[0].Status, "the dependency should be outdated")
+	assert.Equal(t, "2.1.0", res[0].LatestVersion.String())
+	assert.Equal(t, Statuses.Unresolvable, res[1].Status, "testdependency1 is not in the index")
+
+	// The index is cached using the name of the configured repository by helm repo update.
+	settings := newTestRepositoriesSettings(t)
+	settings.RepositoryCache = t.TempDir()
+	index, err := ioutil.ReadFile(filepath.Join("fixtures", "repository", "index.yaml"))
+	require.NoError(t, err, "there must be no error reading the repository index")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(settings.RepositoryCache, helmpath.CacheIndexFile("evil-corp")), index, 0644), "there must be no error writing the cached index")
+
+	res, err = check(settings, &Filter{DependencyNames: []string{"testdependency"}})
+	require.NoError(t, err, "there should be no error listing the dependencies")
+	require.Len(t, res, 2, "there should be a result for every dependency")
+	assert.Equal(t, Statuses.Outdated, res[0].Status, "the dependency should be outdated")
+	assert.Equal(t, "2.1.0", res[0].LatestVersion.String())
+	assert.Equal(t, Statuses.Unresolvable, res[1].Status, "testdependency1 is not in the index")
+
+	// Without a cached index, the latest version is unknown.
+	settings.RepositoryCache = t.TempDir()
+	res, err = check(settings, &Filter{})
+	require.NoError(t, err, "there should be no error listing the dependencies")
+	require.Len(t, res, 2, "all dependencies should be reported")
+	for _, r := range res {
+		assert.Equal(t, ErrNoCachedIndex, r.Err, "the index of %s should be missing", r.Name)
+		assert.Equal(t, Statuses.Unknown, r.Status, "the latest version of %s should be unknown", r.Name)
+		assert.False(t, r.Failed(), "%s should not have failed as its repository was not contacted", r.Name)
+		assert.Equal(t, "unknown (no cached index)", formatStatus(r))
+		assert.Nil(t, r.LatestVersion, "the latest version of %s should be unknown", r.Name)
+		assert.False(t, r.IsOutdated(), "%s should not be outdated", r.Name)
+	}
+}
@@ -0,0 +1,217 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// defaultConcurrency is the number of repositories updated and dependencies resolved at the same time.
+const defaultConcurrency = 8
+
+// indexCache parses each index file once. An index is parsed again only if the file changed on disk.
+type indexCache struct {
+	mu      sync.Mutex
+	entries map[string]*indexCacheEntry
+}
+
+type indexCacheEntry struct {
+	modTime time.Time
+	size    int64
+	// done is closed once the index is parsed.
+	done  chan struct{}
+	index *repo.IndexFile
+	err   error
+}
+
+func newIndexCache() *indexCache {
+	return &indexCache{entries: map[string]*indexCacheEntry{}}
+}
+
+type indexCacheKey struct{}
+
+// withIndexCache returns a context carrying the index cache.
+func withIndexCache(ctx context.Context, indexes *indexCache) context.Context {
+	return context.WithValue(ctx, indexCacheKey{}, indexes)
+}
+
+// indexCacheFrom returns the index cache carried by the context or a new one, which is not reused.
+func indexCacheFrom(ctx context.Context) *indexCache {
+	if indexes, ok := ctx.Value(indexCacheKey{}).(*indexCache); ok {
+		return indexes
+	}
+	return newIndexCache()
+}
+
+// put adds the index parsed from the given file.
+func (c *indexCache) put(indexFile string, index *repo.IndexFile) {
+	fi, err := os.Stat(indexFile)
+	if err != nil {
+		return
+	}
+
+	e := &indexCacheEntry{modTime: fi.ModTime(), size: fi.Size(), done: make(chan struct{}), index: index}
+	close(e.done)
+	c.mu.Lock()
+	c.entries[indexFile] = e
+	c.mu.Unlock()
+}
+
+// load returns the parsed index file. Concurrent calls for the same file wait for a single parse.
+// The returned index is shared and must not be modified.
+func (c *indexCache) load(ctx context.Context, indexFile string) (*repo.IndexFile, error) {
+	fi, err := os.Stat(indexFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	e, ok := c.entries[indexFile]
+	if ok && e.modTime.Equal(fi.ModTime()) && e.size == fi.Size() {
+		c.mu.Unlock()
+		<-e.done
+		return e.index, e.err
+	}
+
+	e = &indexCacheEntry{modTime: fi.ModTime(), size: fi.Size(), done: make(chan struct{})}
+	c.entries[indexFile] = e
+	c.mu.Unlock()
+
+	loggerFrom(ctx).Debugf("Loading cached index file %s", indexFile)
+	e.index, e.err = repo.LoadIndexFile(indexFile)
+	close(e.done)
+	return e.index, e.err
+}
+
+// resolveDependencies looks up the latest versions of the dependencies concurrently.
+// The policies are the ones for the dependencies. Dependencies of repositories which failed to update are reported as
+// unreachable. A result is returned for every dependency in the given order.
+func resolveDependencies(ctx context.Context, deps []*chart.Dependency, policies map[*chart.Dependency]*Policy, repos repositories, settings *cli.EnvSettings, repoOptions *RepositoryOptions, failedRepos map[string]error) []*Result {
+	res := make([]*Result, len(deps))
+	forEach(len(deps), repoOptions.concurrency(), func(i int) {
+		dep := deps[i]
+		if err := repositoryError(failedRepos, dep.Repository); err != nil {
+			res[i] = newFailedResult(dep, nil, Statuses.RepoUnreachable, errors.Wrap(err, "failed to update the repository index"))
+			res[i].Policy = policies[dep]
+			res[i].Deprecation = findDeprecation(ctx, dep, nil, nil, repos, settings)
+			return
+		}
+		res[i] = resolveDependency(ctx, dep, policies[dep], repos, settings, repoOptions)
+	})
+	return res
+}
+
+// resolveDependency returns the result for the dependency. The policy must be the one for the dependency.
+func resolveDependency(ctx context.Context, dep *chart.Dependency, depPolicy *Policy, repos repositories, settings *cli.EnvSettings, repoOptions *RepositoryOptions) *Result {
+	// The version of a dependency might be an exact version or a constraint like ~1.2.0 .
+	constraint, err := semver.NewConstraint(dep.Version)
+	if err != nil {
+		r := newFailedResult(dep, nil, Statuses.InvalidVersion, errors.Wrapf(err, "invalid version %q", dep.Version))
+		r.Policy = depPolicy
+		return r
+	}
+
+	chartVersions, err := loadChartVersions(ctx, dep, repos, settings, repoOptions)
+	if err != nil {
+		status := Statuses.RepoUnreachable
+		switch cause := errors.Cause(err); {
+		case cause == ErrNoCachedIndex:
+			status = Statuses.Unknown
+		case cause == repo.ErrNoChartName || cause == repo.ErrNoChartVersion || strings.Contains(dep.Repository, filePrefix):
+			status = Statuses.Unresolvable
+		}
+		loggerFrom(ctx).Debugf("Failed to load the versions of %s: %s", dep.Name, err)
+
+		// Dead repositories cannot be loaded anymore but should still be reported as deprecated.
+		r := newFailedResult(dep, constraint, status, err)
+		r.Policy = depPolicy
+		r.Deprecation = findDeprecation(ctx, dep, nil, nil, repos, settings)
+		return r
+	}
+
+	latestSatisfyingVersion, latestVersion, cooldown, err := findLatestVersionOfDependency(ctx, dep, chartVersions, constraint, depPolicy)
+	if err != nil {
+		r := newFailedResult(dep, constraint, Statuses.Unresolvable, err)
+		r.Policy = depPolicy
+		r.Deprecation = findDeprecation(ctx, dep, chartVersions, r.CurrentVersion, repos, settings)
+		return r
+	}
+
+	if cooldown != nil {
+		loggerFrom(ctx).Infof("Dependency %s: %s", dep.Name, cooldown.String())
+	}
+
+	r := newResult(dep, constraint, latestSatisfyingVersion, latestVersion)
+	r.Status = Statuses.OK
+	if r.IsOutdated() {
+		r.Status = Statuses.Outdated
+	}
+	r.Policy = depPolicy
+	r.Cooldown = cooldown
+	r.LatestChart = findChartVersion(chartVersions, latestVersion)
+	r.Deprecation = findDeprecation(ctx, dep, chartVersions, r.CurrentVersion, repos, settings)
+	return r
+}
+
+// repositoryError returns the error of the repository or nil if it did not fail.
+func repositoryError(failedRepos map[string]error, repository string) error {
+	for r, err := range failedRepos {
+		if isSameRepository(r, repository) {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEach calls fn for 0 <= i < n using at most concurrency goroutines and waits for all calls to return.
+func forEach(n, concurrency int, fn func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg      sync.WaitGroup
+		pending = make(chan int)
+	)
+	for w := 0; w < concurrency && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range pending {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		pending <- i
+	}
+	close(pending)
+	wg.Wait()
+}
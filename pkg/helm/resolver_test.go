@@ -0,0 +1,215 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+func TestIndexCacheLoadsIndexOnce(t *testing.T) {
+	settings := newTestSettings(t)
+	indexFile := filepath.Join(settings.RepositoryCache, helmpath.CacheIndexFile(normalizeRepoName(testRepository)))
+	c := newIndexCache()
+
+	var (
+		wg     sync.WaitGroup
+		loaded = make([]*repo.IndexFile, 10)
+		errs   = make([]error, 10)
+	)
+	for i := range loaded {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			loaded[i], errs[i] = c.load(context.Background(), indexFile)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range loaded {
+		require.NoError(t, errs[i], "there should be no error loading the index")
+		assert.True(t, loaded[0] == loaded[i], "the index should only be parsed once")
+	}
+
+	// A changed index is parsed again.
+	require.NoError(t, ioutil.WriteFile(indexFile, []byte("apiVersion: v1\nentries: {}\n"), 0644), "there must be no error writing the index")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(indexFile, later, later), "there must be no error changing the modification time")
+
+	idx, err := c.load(context.Background(), indexFile)
+	require.NoError(t, err, "there should be no error loading the changed index")
+	assert.Empty(t, idx.Entries, "the changed index should have been parsed")
+
+	_, err = c.load(context.Background(), filepath.Join(settings.RepositoryCache, "missing-index.yaml"))
+	assert.Error(t, err, "loading a missing index should fail")
+}
+
+func TestForEach(t *testing.T) {
+	var (
+		running, maxRunning int32
+		called              = make([]bool, 20)
+	)
+	forEach(len(called), 3, func(i int) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		called[i] = true
+		atomic.AddInt32(&running, -1)
+	})
+
+	for i, c := range called {
+		assert.True(t, c, "fn should have been called for %d", i)
+	}
+	assert.True(t, maxRunning <= 3, "at most 3 calls should run at the same time, got %d", maxRunning)
+}
+
+func TestResolveDependencies(t *testing.T) {
+	settings := newTestSettings(t)
+	deps := []*chart.Dependency{
+		{Name: "testdependency", Version: "1.2.0", Repository: testRepository},
+		{Name: "unknown", Version: "1.0.0", Repository: testRepository},
+		{Name: "testdependency", Version: "~1.2.0", Repository: testRepository, Alias: "pinned"},
+		{Name: "testdependency", Version: "2.1.0", Repository: testRepository, Alias: "latest"},
+		{Name: "testdependency", Version: "not a version", Repository: testRepository, Alias: "invalid"},
+		{Name: "testdependency", Version: "1.2.0", Repository: "https://unreachable.example.com/"},
+	}
+	failedRepos := map[string]error{"https://unreachable.example.com": errors.New("connection refused")}
+
+	res := resolveDependencies(context.Background(), deps, map[*chart.Dependency]*Policy{}, nil, settings, &RepositoryOptions{Offline: true, Concurrency: 2}, failedRepos)
+	require.Len(t, res, len(deps), "there should be a result for every dependency")
+	for i, r := range res {
+		assert.True(t, deps[i] == r.Dependency, "the order of the dependencies should be kept")
+	}
+
+	assert.Equal(t, Statuses.Outdated, res[0].Status)
+	assert.Equal(t, "2.1.0", res[0].LatestVersion.String())
+	assert.NoError(t, res[0].Err)
+
+	assert.Equal(t, Statuses.Unresolvable, res[1].Status)
+	assert.Equal(t, repo.ErrNoChartName, res[1].Err)
+
+	assert.Equal(t, Statuses.Outdated, res[2].Status)
+	assert.Equal(t, "1.2.5", res[2].LatestSatisfyingVersion.String())
+
+	assert.Equal(t, Statuses.OK, res[3].Status)
+	assert.False(t, res[3].Failed(), "an up to date dependency should not fail")
+
+	assert.Equal(t, Statuses.InvalidVersion, res[4].Status)
+	assert.Error(t, res[4].Err)
+
+	assert.Equal(t, Statuses.RepoUnreachable, res[5].Status)
+	assert.Contains(t, res[5].Err.Error(), "connection refused")
+	assert.False(t, res[5].IsOutdated(), "the dependency of an unreachable repository should not be outdated")
+}
+
+const benchmarkRepository = "https://charts.example.com"
+
+// newBenchmarkSettings returns settings with a repository cache containing a synthetic index of the given number of
+// charts with the given number of versions each.
+func newBenchmarkSettings(b *testing.B, charts, versions int) *cli.EnvSettings {
+	dir, err := ioutil.TempDir("", "helm-outdated")
+	require.NoError(b, err, "there must be no error creating the repository cache")
+	b.Cleanup(func() { os.RemoveAll(dir) })
+
+	var buf strings.Builder
+	buf.WriteString("apiVersion: v1\nentries:\n")
+	for c := 0; c < charts; c++ {
+		fmt.Fprintf(&buf, "  chart-%d:\n", c)
+		for v := 0; v < versions; v++ {
+			fmt.Fprintf(&buf, "  - apiVersion: v2\n    name: chart-%d\n    version: %d.%d.0\n    created: \"2020-12-01T00:00:00Z\"\n", c, v/10+1, v%10)
+			fmt.Fprintf(&buf, "    description: A synthetic chart for benchmarks\n    digest: %064d\n", v)
+			fmt.Fprintf(&buf, "    urls:\n    - %s/chart-%d-%d.%d.0.tgz\n", benchmarkRepository, c, v/10+1, v%10)
+		}
+	}
+	buf.WriteString("generated: \"2020-12-01T00:00:00Z\"\n")
+
+	settings := cli.New()
+	settings.RepositoryCache = dir
+	require.NoError(b,
+		ioutil.WriteFile(filepath.Join(dir, helmpath.CacheIndexFile(normalizeRepoName(benchmarkRepository))), []byte(buf.String()), 0644),
+		"there must be no error writing the index",
+	)
+	return settings
+}
+
+// BenchmarkResolveDependencies resolves 15 dependencies from the same large repository.
+// The index-per-dependency case parses the index for every dependency one after another as done before the index
+// cache was introduced.
+func BenchmarkResolveDependencies(b *testing.B) {
+	settings := newBenchmarkSettings(b, 200, 20)
+	var deps []*chart.Dependency
+	for i := 0; i < 15; i++ {
+		deps = append(deps, &chart.Dependency{Name: fmt.Sprintf("chart-%d", i*10), Version: "1.0.0", Repository: benchmarkRepository})
+	}
+	indexFile := filepath.Join(settings.RepositoryCache, helmpath.CacheIndexFile(normalizeRepoName(benchmarkRepository)))
+	repoOptions := &RepositoryOptions{Offline: true}
+
+	b.Run("index-per-dependency", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for _, dep := range deps {
+				idx, err := repo.LoadIndexFile(indexFile)
+				require.NoError(b, err, "there must be no error loading the index")
+				constraint, err := semver.NewConstraint(dep.Version)
+				require.NoError(b, err, "there must be no error parsing the constraint")
+				_, _, _, err = findLatestVersionOfDependency(context.Background(), dep, idx.Entries[dep.Name], constraint, nil)
+				require.NoError(b, err, "there must be no error resolving %s", dep.Name)
+			}
+		}
+	})
+
+	b.Run("shared-index", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			// Start without parsed indexes as a new process would.
+			ctx := withIndexCache(context.Background(), newIndexCache())
+			res := resolveDependencies(ctx, deps, map[*chart.Dependency]*Policy{}, nil, settings, repoOptions, nil)
+			require.Len(b, res, len(deps), "all dependencies should be outdated")
+		}
+	})
+
+	b.Run("shared-index-reused", func(b *testing.B) {
+		ctx := withIndexCache(context.Background(), newIndexCache())
+		for n := 0; n < b.N; n++ {
+			res := resolveDependencies(ctx, deps, map[*chart.Dependency]*Policy{}, nil, settings, repoOptions, nil)
+			require.Len(b, res, len(deps), "all dependencies should be outdated")
+		}
+	})
+}
@@ -20,16 +20,180 @@
 package helm
 
 import (
+	"fmt"
 	"sort"
-    "helm.sh/helm/v3/pkg/chart"
-	"github.com/Masterminds/semver"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
 )
 
+// Status is one of Statuses.
+type Status string
+
+// Statuses enumerates the available Status of a Result.
+var Statuses = struct {
+	// OK means the dependency uses the latest version allowed by the policy.
+	OK Status
+	// Outdated means a newer version allowed by the policy is available.
+	Outdated Status
+	// Unresolvable means the chart or a version allowed by the policy was not found.
+	Unresolvable Status
+	// RepoUnreachable means the index of the repository could not be downloaded or read.
+	RepoUnreachable Status
+	// InvalidVersion means the version or constraint declared by the dependency cannot be parsed.
+	InvalidVersion Status
+	// Unknown means the latest version is unknown as the index of the repository is not cached in offline mode.
+	Unknown Status
+}{
+	"ok",
+	"outdated",
+	"unresolvable",
+	"repo-unreachable",
+	"invalid-version",
+	"unknown",
+}
+
 // Result ...
 type Result struct {
 	*chart.Dependency
-	CurrentVersion,
+	// CurrentVersion is the version of the dependency. If the dependency declares a constraint instead of an exact
+	// version, this is the latest version satisfying the constraint.
+	CurrentVersion *semver.Version
+	// LatestSatisfyingVersion is the latest available version satisfying the declared version constraint.
+	LatestSatisfyingVersion *semver.Version
+	// LatestVersion is the latest available version.
 	LatestVersion *semver.Version
+	// Constraint is the parsed version or version constraint of the dependency.
+	Constraint *semver.Constraints
+	// NeedsWidening indicates that the latest version does not satisfy the constraint of the dependency.
+	NeedsWidening bool
+	// Policy is the policy applied when looking for the latest version.
+	Policy *Policy
+	// Deprecation is set if the dependency, its version or its repository is deprecated.
+	Deprecation *Deprecation
+	// Status tells whether the dependency is outdated or why it could not be checked.
+	Status Status
+	// Err is the reason why the latest version of the dependency is unknown, e.g. ErrNoCachedIndex .
+	// It is set for every Status except OK and Outdated.
+	Err error
+	// Cooldown is a version newer than the latest version which is not proposed yet as it was released recently.
+	Cooldown *Cooldown
+	// Position is where the version of the dependency is declared or nil if it is unknown.
+	Position *Position
+	// LatestChart is the metadata of the latest version, e.g. its home and sources, as found in the repository index.
+	// It is nil if the latest version is unknown.
+	LatestChart *chart.Metadata
+}
+
+// Position is a location in a file of a chart.
+type Position struct {
+	// File is the path of the file relative to the chart, e.g. Chart.yaml .
+	File string
+	// Line and Column start at 1.
+	Line   int
+	Column int
+}
+
+// Cooldown is a version released less than the minimum release age ago.
+type Cooldown struct {
+	Version *semver.Version
+	// Until is the time when the version can be proposed.
+	Until time.Time
+}
+
+// String returns a description of the cooldown, e.g. for the status of the dependency.
+func (c *Cooldown) String() string {
+	return fmt.Sprintf("newer version %s exists but is in cooldown until %s", c.Version.String(), c.Until.Format(time.RFC3339))
+}
+
+func newResult(dep *chart.Dependency, constraint *semver.Constraints, latestSatisfyingVersion, latestVersion *semver.Version) *Result {
+	currentVersion := getCurrentVersion(dep, latestSatisfyingVersion)
+
+	return &Result{
+		Dependency:              dep,
+		CurrentVersion:          currentVersion,
+		LatestSatisfyingVersion: latestSatisfyingVersion,
+		LatestVersion:           latestVersion,
+		Constraint:              constraint,
+		NeedsWidening:           latestVersion != nil && !constraint.Check(latestVersion) && (currentVersion == nil || latestVersion.GreaterThan(currentVersion)),
+	}
+}
+
+// newFailedResult returns the result for a dependency which could not be checked. The constraint might be nil.
+func newFailedResult(dep *chart.Dependency, constraint *semver.Constraints, status Status, err error) *Result {
+	r := newResult(dep, constraint, nil, nil)
+	r.Status = status
+	r.Err = err
+	return r
+}
+
+// Failed checks whether the dependency could not be checked. Dependencies with an unknown latest version in offline
+// mode did not fail as their repository was not contacted.
+func (r *Result) Failed() bool {
+	return r.Err != nil && r.Status != Statuses.Unknown
+}
+
+// IsOutdated checks whether a newer version than the current one is available.
+func (r *Result) IsOutdated() bool {
+	if r.LatestVersion == nil {
+		return false
+	}
+	return r.CurrentVersion == nil || r.LatestVersion.GreaterThan(r.CurrentVersion)
+}
+
+// IsOutdatedBeyond checks whether the latest version is at least the given change away from the current one.
+// With IncTypes.Patch or an empty threshold, this is the same as IsOutdated.
+func (r *Result) IsOutdatedBeyond(threshold IncType) bool {
+	if !r.IsOutdated() {
+		return false
+	}
+	if threshold == "" || threshold == IncTypes.Patch {
+		return true
+	}
+	bump := GetIncType(r.CurrentVersion, r.LatestVersion)
+	return bump != IncTypes.None && !bump.IsGreater(threshold)
+}
+
+// findChartVersion returns the metadata of the given version of the chart or nil if it is not found.
+func findChartVersion(chartVersions repo.ChartVersions, version *semver.Version) *chart.Metadata {
+	if version == nil {
+		return nil
+	}
+	for _, cv := range chartVersions {
+		if v, err := semver.NewVersion(cv.Version); err == nil && v.Equal(version) {
+			return cv.Metadata
+		}
+	}
+	return nil
+}
+
+// getCurrentVersion returns the version of the dependency. If a constraint is declared instead of an exact version,
+// the latest version satisfying it would be used.
+func getCurrentVersion(dep *chart.Dependency, latestSatisfyingVersion *semver.Version) *semver.Version {
+	if isExactVersion(dep.Version) {
+		v, _ := semver.NewVersion(dep.Version)
+		return v
+	}
+	return latestSatisfyingVersion
+}
+
+// getConstraintVersion returns the first version declared in the constraint or nil.
+func getConstraintVersion(constraint string) *semver.Version {
+	for _, m := range comparatorRegex.FindAllStringSubmatch(constraint, -1) {
+		if v, err := semver.NewVersion(strings.NewReplacer("x", "0", "X", "0", "*", "0").Replace(m[2])); err == nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// isExactVersion checks whether the given version is a complete semantic version rather than a constraint.
+func isExactVersion(version string) bool {
+	_, err := semver.StrictNewVersion(strings.TrimPrefix(version, "v"))
+	return err == nil
 }
 
 func sortResultsAlphabetically(res []*Result) []*Result {
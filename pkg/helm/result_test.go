@@ -0,0 +1,33 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestResultWithoutLatestVersion(t *testing.T) {
+	dep := &chart.Dependency{Name: "testdependency", Version: "1.2.0", Repository: "https://kubernetes-charts.storage.googleapis.com"}
+	r := newResult(dep, mustConstraint(t, dep.Version), nil, nil)
+	assert.False(t, r.IsOutdated(), "a dependency without known versions should not be outdated")
+}
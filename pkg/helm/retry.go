@@ -0,0 +1,123 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxRetries is the number of times a request failing with a transient error is retried.
+const maxRetries = 3
+
+// retryBackoff is the delay before the first retry. It is doubled for each further retry. Replaced in tests.
+var retryBackoff = 500 * time.Millisecond
+
+// maxRetryDelay returns the longest delay before a retry, which is the backoff of the last retry. It also limits the
+// delay requested by a Retry-After header.
+func maxRetryDelay() time.Duration {
+	return retryBackoff << (maxRetries - 1)
+}
+
+// doWithRetry sends the request returned by newRequest and retries it with exponential backoff if it fails with a
+// transient error like a refused connection, a timeout or a 503 response. The response of the last attempt is returned.
+// The request is created anew for every attempt and bound to the context, which also aborts waiting for a retry.
+func doWithRetry(ctx context.Context, client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := client.Do(req.WithContext(ctx))
+		if ctx.Err() != nil {
+			if res != nil {
+				res.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		if attempt >= maxRetries || (err != nil && !isTransientError(err)) || (err == nil && !isTransientStatus(res.StatusCode)) {
+			return res, err
+		}
+
+		delay := backoff
+		if err != nil {
+			loggerFrom(ctx).Debugf("Retrying %s in %s after error: %s", req.URL.String(), delay, err)
+		} else {
+			if d := retryAfter(res); d > delay {
+				delay = d
+			}
+			if max := maxRetryDelay(); delay > max {
+				delay = max
+			}
+			res.Body.Close()
+			loggerFrom(ctx).Debugf("Retrying %s in %s after response %s", req.URL.String(), delay, res.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		backoff *= 2
+	}
+}
+
+// isTransientError checks whether a request failing with the error might succeed later. Errors like unknown hosts or
+// invalid certificates are permanent.
+func isTransientError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// isTransientStatus checks whether a request failing with the status code might succeed later.
+func isTransientStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay requested by the Retry-After header of the response in seconds or 0.
+func retryAfter(res *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
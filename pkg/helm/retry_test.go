@@ -0,0 +1,216 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// withShortRetryBackoff makes retries fast for the duration of the test.
+func withShortRetryBackoff(t *testing.T) {
+	backoff := retryBackoff
+	t.Cleanup(func() { retryBackoff = backoff })
+	retryBackoff = time.Millisecond
+}
+
+// newUnavailableServer returns a server responding with 503 to the given number of requests and serving the index of
+// the test repository afterwards. The number of requests is counted.
+func newUnavailableServer(t *testing.T, failures int32, requests *int32) *httptest.Server {
+	index, err := ioutil.ReadFile(filepath.Join("fixtures", "repository", "index.yaml"))
+	require.NoError(t, err, "there must be no error reading the repository index")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(requests, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(index)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newStallingServer returns a server which never responds until the request is cancelled.
+func newStallingServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUpdateIndexFileRetriesTransientErrors(t *testing.T) {
+	withShortRetryBackoff(t)
+
+	var requests int32
+	srv := newUnavailableServer(t, 2, &requests)
+	_, err := updateIndexFile(context.Background(), &repo.Entry{Name: "test", URL: srv.URL}, t.TempDir(), 0)
+	require.NoError(t, err, "the index should be downloaded after retrying")
+	assert.Equal(t, int32(3), requests, "the request should have been retried twice")
+
+	requests = 0
+	srv = newUnavailableServer(t, 100, &requests)
+	_, err = updateIndexFile(context.Background(), &repo.Entry{Name: "test", URL: srv.URL}, t.TempDir(), 0)
+	assert.Error(t, err, "the update should fail if the repository stays unavailable")
+	assert.Equal(t, int32(maxRetries+1), requests, "the request should have been retried %d times", maxRetries)
+}
+
+func TestUpdateIndexFileDoesNotRetryPermanentErrors(t *testing.T) {
+	withShortRetryBackoff(t)
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	_, err := updateIndexFile(context.Background(), &repo.Entry{Name: "test", URL: srv.URL}, t.TempDir(), 0)
+	assert.Error(t, err, "the update should fail")
+	assert.Equal(t, int32(1), requests, "a missing index should not be requested again")
+}
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"connection refused", &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, true},
+		{"connection reset", &url.Error{Op: "Get", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		{"connection closed", &url.Error{Op: "Get", Err: io.EOF}, true},
+		{"dns timeout", &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}}, true},
+		{"no such host", &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}}, false},
+		{"unknown certificate", &url.Error{Op: "Get", Err: x509.UnknownAuthorityError{}}, false},
+		{"invalid certificate", &url.Error{Op: "Get", Err: x509.CertificateInvalidError{Reason: x509.Expired}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.transient, isTransientError(tt.err))
+		})
+	}
+}
+
+func TestUpdateIndexFileDoesNotRetryUnknownCertificate(t *testing.T) {
+	withShortRetryBackoff(t)
+
+	var connections int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	_, err := updateIndexFile(context.Background(), &repo.Entry{Name: "test", URL: srv.URL}, t.TempDir(), 0)
+	assert.Error(t, err, "the certificate of the repository should not be trusted")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&connections), "an unknown certificate should not be retried")
+}
+
+func TestUpdateIndexFileLimitsRetryAfter(t *testing.T) {
+	withShortRetryBackoff(t)
+
+	var requests int32
+	index, err := ioutil.ReadFile(filepath.Join("fixtures", "repository", "index.yaml"))
+	require.NoError(t, err, "there must be no error reading the repository index")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write(index)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	_, err = updateIndexFile(context.Background(), &repo.Entry{Name: "test", URL: srv.URL}, t.TempDir(), 0)
+	require.NoError(t, err, "the index should be downloaded after retrying")
+	assert.Equal(t, int32(2), requests, "the request should have been retried once")
+	assert.True(t, time.Since(start) < 5*time.Second, "the delay of the retry should be limited to the max backoff")
+}
+
+func TestUpdateIndexFileTimeout(t *testing.T) {
+	srv := newStallingServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := updateIndexFile(ctx, &repo.Entry{Name: "test", URL: srv.URL}, t.TempDir(), 0)
+	assert.Equal(t, context.DeadlineExceeded, err, "the update should be aborted")
+	assert.True(t, time.Since(start) < 5*time.Second, "the update should be aborted after the timeout")
+}
+
+func TestParallelRepoUpdateWithStallingRepository(t *testing.T) {
+	withShortRetryBackoff(t)
+
+	var requests int32
+	stalling := newStallingServer(t)
+	available := newUnavailableServer(t, 1, &requests)
+	deps := []*chart.Dependency{
+		{Name: "testdependency", Version: "1.2.0", Repository: stalling.URL},
+		{Name: "testdependency", Version: "1.2.0", Repository: available.URL},
+	}
+
+	settings := cli.New()
+	settings.RepositoryCache = t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	statuses := parallelRepoUpdate(ctx, deps, nil, &RepositoryOptions{Concurrency: 2}, settings)
+	require.Len(t, statuses, 2, "there should be a status for every repository")
+	assert.False(t, statuses[0].Updated, "the stalling repository should not be updated")
+	assert.True(t, statuses[1].Updated, "the available repository should be updated")
+
+	failed := failedRepositories(statuses)
+	require.Len(t, failed, 1, "only the stalling repository should fail")
+	assert.Equal(t, context.DeadlineExceeded, failed[stalling.URL], "the stalling repository should time out")
+	assert.True(t, fileExists(filepath.Join(settings.RepositoryCache, helmpath.CacheIndexFile(normalizeRepoName(available.URL)))),
+		"the index of the available repository should be downloaded")
+
+	res := resolveDependencies(context.Background(), deps, map[*chart.Dependency]*Policy{}, nil, settings, &RepositoryOptions{}, failed)
+	require.Len(t, res, 2, "there should be a result for every dependency")
+	assert.Equal(t, Statuses.RepoUnreachable, res[0].Status, "the stalling repository should be unreachable")
+	assert.Equal(t, Statuses.Outdated, res[1].Status, "the dependency of the available repository should be resolved")
+}
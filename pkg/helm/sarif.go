@@ -0,0 +1,219 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	toolName     = "helm-outdated"
+	toolURI      = "https://github.com/uniknow/helm-outdated"
+)
+
+// sarifRule is a kind of finding reported in SARIF output.
+type sarifRule struct {
+	ID    string
+	Level string
+	Text  string
+}
+
+// sarifRules are the rules of the SARIF output. Outdated dependencies are reported with a rule per bump type, so the
+// severity reflects how likely an update breaks the chart.
+var sarifRules = struct {
+	Major, Minor, Patch, Deprecated sarifRule
+}{
+	Major:      sarifRule{ID: "outdated-major", Level: "error", Text: "A new major version of the dependency is available."},
+	Minor:      sarifRule{ID: "outdated-minor", Level: "warning", Text: "A new minor version of the dependency is available."},
+	Patch:      sarifRule{ID: "outdated-patch", Level: "note", Text: "A new patch version of the dependency is available."},
+	Deprecated: sarifRule{ID: "deprecated", Level: "warning", Text: "The dependency, its version or its repository is deprecated."},
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string                `json:"name"`
+	InformationURI string                `json:"informationUri"`
+	Rules          []sarifRuleDescriptor `json:"rules"`
+}
+
+type sarifRuleDescriptor struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// writeSARIF writes the outdated and deprecated dependencies of the chart in the given path as SARIF log.
+// Dependencies which could not be checked are not included.
+func writeSARIF(w io.Writer, chartPath string, results []*Result) error {
+	c, err := loader.Load(chartPath)
+	if err != nil {
+		return err
+	}
+
+	rules := []sarifRule{sarifRules.Major, sarifRules.Minor, sarifRules.Patch, sarifRules.Deprecated}
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           toolName,
+			InformationURI: toolURI,
+		}},
+		Results: []sarifResult{},
+	}
+	for _, rule := range rules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRuleDescriptor{
+			ID:                   rule.ID,
+			ShortDescription:     sarifMessage{Text: rule.Text},
+			DefaultConfiguration: sarifConfiguration{Level: rule.Level},
+		})
+	}
+
+	addResult := func(r *Result, rule sarifRule, message string) {
+		res := sarifResult{
+			RuleID:    rule.ID,
+			Level:     rule.Level,
+			Message:   sarifMessage{Text: message},
+			Locations: []sarifLocation{sarifLocationOf(chartPath, dependenciesFileName(c), r)},
+		}
+		for i := range rules {
+			if rules[i].ID == rule.ID {
+				res.RuleIndex = i
+			}
+		}
+		run.Results = append(run.Results, res)
+	}
+
+	for _, r := range results {
+		name := r.Name
+		if r.Alias != "" {
+			name = fmt.Sprintf("%s (%s)", r.Alias, r.Name)
+		}
+
+		if r.IsOutdated() {
+			rule := sarifRules.Patch
+			switch GetIncType(r.CurrentVersion, r.LatestVersion) {
+			case IncTypes.Major:
+				rule = sarifRules.Major
+			case IncTypes.Minor:
+				rule = sarifRules.Minor
+			}
+			addResult(r, rule, fmt.Sprintf("Dependency %s %s is outdated, the latest version is %s.", name, r.Version, r.LatestVersion.String()))
+		}
+		if r.Deprecation != nil {
+			addResult(r, sarifRules.Deprecated, fmt.Sprintf("Dependency %s is deprecated: %s", name, r.Deprecation.String()))
+		}
+	}
+
+	data, err := json.MarshalIndent(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// sarifLocationOf returns the location of the declaration of the dependency. Without a known position, the location
+// is the given file declaring the dependencies.
+func sarifLocationOf(chartPath, dependenciesFile string, r *Result) sarifLocation {
+	fileName, region := dependenciesFile, (*sarifRegion)(nil)
+	if r.Position != nil {
+		fileName = r.Position.File
+		region = &sarifRegion{StartLine: r.Position.Line, StartColumn: r.Position.Column}
+	}
+	return sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: sarifURI(filepath.Join(chartPath, fileName))},
+		Region:           region,
+	}}
+}
+
+// sarifURI returns the path relative to the working directory, which is usually the root of the scanned repository.
+// Paths outside of the working directory are returned as absolute file URI.
+func sarifURI(path string) string {
+	if filepath.IsAbs(path) {
+		wd, err := os.Getwd()
+		if err == nil {
+			if rel, err := filepath.Rel(wd, path); err == nil && !isOutsideDir(rel) {
+				return filepath.ToSlash(rel)
+			}
+		}
+		return "file://" + filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(path)
+}
+
+// isOutsideDir checks whether the relative path leaves its base directory. Names starting with .. like ..values do not.
+func isOutsideDir(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
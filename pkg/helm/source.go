@@ -0,0 +1,189 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// VersionSource looks up the versions of charts in the repositories of a URL scheme.
+// Sources are registered with RegisterVersionSource and must be safe for concurrent use.
+type VersionSource interface {
+	// ChartVersions returns all versions of the chart with the given name found in the repository.
+	// repo.ErrNoChartName or repo.ErrNoChartVersion are returned if there are none, other errors mark the repository
+	// as unreachable. In offline mode, only cached data may be used and ErrNoCachedIndex is returned if there is none.
+	ChartVersions(ctx context.Context, req *SourceRequest, name string) (repo.ChartVersions, error)
+}
+
+// IndexUpdater is implemented by version sources which cache an index of the repository.
+// Update is called once per repository before the dependencies are resolved, except in offline mode. It returns the
+// path of the updated index. Its repositories are reported in Report.Repositories.
+type IndexUpdater interface {
+	Update(ctx context.Context, req *SourceRequest) (string, error)
+}
+
+// SourceRequest describes the repository a VersionSource is asked about.
+type SourceRequest struct {
+	// Repository is the URL of the repository, e.g. https://charts.example.com .
+	Repository string
+	// Entry is the repository with the authentication and TLS settings used to access it. Its name is the one of the
+	// index downloaded by this plugin.
+	Entry *repo.Entry
+	// Settings locate the repository cache and the registry config of Helm.
+	Settings *cli.EnvSettings
+	// Options control how repositories are accessed.
+	Options *RepositoryOptions
+
+	repos repositories
+}
+
+// CachedIndexFile returns the path of the cached index of the repository or ErrNoCachedIndex if there is none.
+// The index might have been downloaded by Update or helm repo update.
+func (r *SourceRequest) CachedIndexFile() (string, error) {
+	return r.repos.cachedIndexFile(r.Repository, r.Settings)
+}
+
+var (
+	versionSourcesMu sync.RWMutex
+	// versionSources are the registered sources by scheme.
+	versionSources = map[string]VersionSource{
+		"http":  indexSource{},
+		"https": indexSource{},
+		"file":  localSource{},
+		"oci":   ociSource{},
+	}
+	// defaultVersionSource is used for schemes without a registered source.
+	defaultVersionSource VersionSource = getterSource{}
+)
+
+// RegisterVersionSource registers the source for repositories with the given URL scheme, e.g. s3 for s3://charts .
+// A source registered before for the scheme, including the built-in ones for http, https, file and oci, is replaced.
+// Repositories of other schemes are fetched by the downloader plugins of Helm.
+func RegisterVersionSource(scheme string, source VersionSource) {
+	versionSourcesMu.Lock()
+	defer versionSourcesMu.Unlock()
+	versionSources[strings.ToLower(scheme)] = source
+}
+
+// versionSourceFor returns the source for the scheme of the repository.
+func versionSourceFor(repository string) VersionSource {
+	versionSourcesMu.RLock()
+	defer versionSourcesMu.RUnlock()
+	if source, ok := versionSources[repositoryScheme(repository)]; ok {
+		return source
+	}
+	return defaultVersionSource
+}
+
+// repositoryScheme returns the lower case scheme of the repository URL or an empty string if it has none.
+func repositoryScheme(repository string) string {
+	idx := strings.Index(repository, "://")
+	if idx < 0 {
+		return ""
+	}
+	return strings.ToLower(repository[:idx])
+}
+
+// newSourceRequest returns the request for the repository with the given URL.
+func newSourceRequest(ctx context.Context, repository string, repos repositories, settings *cli.EnvSettings, repoOptions *RepositoryOptions) *SourceRequest {
+	return &SourceRequest{
+		Repository: repository,
+		Entry:      repos.entry(ctx, repository, repoOptions.Credentials),
+		Settings:   settings,
+		Options:    repoOptions,
+		repos:      repos,
+	}
+}
+
+// indexSource reads the versions from the index.yaml of a chart repository served via HTTP.
+type indexSource struct{}
+
+func (indexSource) Update(ctx context.Context, req *SourceRequest) (string, error) {
+	return updateIndexFile(ctx, req.Entry, req.Settings.RepositoryCache, req.Options.IndexMaxAge)
+}
+
+func (indexSource) ChartVersions(ctx context.Context, req *SourceRequest, name string) (repo.ChartVersions, error) {
+	return cachedChartVersions(ctx, req, name)
+}
+
+// getterSource downloads the index.yaml using the getters of Helm, which include the downloader plugins.
+type getterSource struct{}
+
+func (getterSource) Update(ctx context.Context, req *SourceRequest) (string, error) {
+	r, err := repo.NewChartRepository(req.Entry, getter.All(req.Settings))
+	if err != nil {
+		return "", err
+	}
+	r.CachePath = req.Settings.RepositoryCache
+	return downloadWithContext(ctx, r.DownloadIndexFile)
+}
+
+func (getterSource) ChartVersions(ctx context.Context, req *SourceRequest, name string) (repo.ChartVersions, error) {
+	return cachedChartVersions(ctx, req, name)
+}
+
+// cachedChartVersions returns the versions of the chart found in the cached index of the repository.
+func cachedChartVersions(ctx context.Context, req *SourceRequest, name string) (repo.ChartVersions, error) {
+	indexFile, err := req.CachedIndexFile()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the index file for the repository to get chart information and return chart URL
+	repoIndex, err := indexCacheFrom(ctx).load(ctx, indexFile)
+	if err != nil {
+		return nil, err
+	}
+
+	chartVersions, ok := repoIndex.Entries[name]
+	if !ok || len(chartVersions) == 0 {
+		return nil, repo.ErrNoChartName
+	}
+	return chartVersions, nil
+}
+
+// localSource returns the version of a chart in the local file system referred to by file:// .
+type localSource struct{}
+
+func (localSource) ChartVersions(ctx context.Context, req *SourceRequest, name string) (repo.ChartVersions, error) {
+	c, err := loader.Load(strings.TrimPrefix(req.Repository, filePrefix))
+	if err != nil {
+		return nil, err
+	}
+	return repo.ChartVersions{{Metadata: c.Metadata}}, nil
+}
+
+// ociSource lists the tags of a chart in an OCI registry.
+type ociSource struct{}
+
+func (ociSource) ChartVersions(ctx context.Context, req *SourceRequest, name string) (repo.ChartVersions, error) {
+	// Tags of OCI registries are never cached.
+	if req.Options.Offline {
+		return nil, ErrNoCachedIndex
+	}
+	return loadOCIChartVersions(ctx, req, name)
+}
@@ -0,0 +1,114 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// staticSource serves fixed versions and records the updated repositories.
+type staticSource struct {
+	mu       sync.Mutex
+	versions map[string][]string
+	updated  []string
+}
+
+func (s *staticSource) Update(ctx context.Context, req *SourceRequest) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updated = append(s.updated, req.Repository)
+	return "", nil
+}
+
+func (s *staticSource) ChartVersions(ctx context.Context, req *SourceRequest, name string) (repo.ChartVersions, error) {
+	versions, ok := s.versions[name]
+	if !ok {
+		return nil, repo.ErrNoChartName
+	}
+
+	var res repo.ChartVersions
+	for _, v := range versions {
+		res = append(res, &repo.ChartVersion{Metadata: &chart.Metadata{Name: name, Version: v}})
+	}
+	return res, nil
+}
+
+// withVersionSource registers the source for the scheme for the duration of the test.
+func withVersionSource(t *testing.T, scheme string, source VersionSource) {
+	previous, ok := versionSources[scheme]
+	t.Cleanup(func() {
+		if ok {
+			RegisterVersionSource(scheme, previous)
+		} else {
+			versionSourcesMu.Lock()
+			delete(versionSources, scheme)
+			versionSourcesMu.Unlock()
+		}
+	})
+	RegisterVersionSource(scheme, source)
+}
+
+func TestVersionSourceFor(t *testing.T) {
+	testCases := []struct {
+		repository string
+		expected   VersionSource
+	}{
+		{repository: "https://charts.example.com", expected: indexSource{}},
+		{repository: "HTTP://charts.example.com", expected: indexSource{}},
+		{repository: "file:///charts/common", expected: localSource{}},
+		{repository: "oci://registry.example.com/charts", expected: ociSource{}},
+		{repository: "s3://charts", expected: getterSource{}},
+		{repository: "charts", expected: getterSource{}},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, versionSourceFor(tc.repository), "wrong source for %s", tc.repository)
+	}
+}
+
+func TestCheckerWithRegisteredVersionSource(t *testing.T) {
+	source := &staticSource{versions: map[string][]string{"testdependency": {"0.0.1", "1.0.0", "1.1.0"}}}
+	withVersionSource(t, "inhouse", source)
+
+	chartPath := copyFixtureChart(t, "chart-v2")
+	report, err := NewChecker(Options{
+		Settings: newTestSettings(t),
+		Filter:   &Filter{DependencyNames: []string{"testdependency"}},
+		Policy:   &Policy{Repository: "inhouse://store/charts"},
+		Logger:   NopLogger,
+	}).Check(context.Background(), chartPath)
+	require.NoError(t, err, "there should be no error checking the chart")
+
+	assert.Equal(t, []string{"inhouse://store/charts"}, source.updated, "the repository should be updated once")
+	require.Len(t, report.Repositories, 1)
+	assert.True(t, report.Repositories[0].Updated, "the repository should be reported as updated")
+
+	require.Len(t, report.Results, 2, "there should be a result for every dependency")
+	assert.Equal(t, Statuses.Outdated, report.Results[0].Status)
+	assert.Equal(t, "1.1.0", report.Results[0].LatestVersion.String(), "the version should be looked up in the source")
+	assert.Equal(t, Statuses.Unresolvable, report.Results[1].Status, "charts unknown to the source should be unresolvable")
+}
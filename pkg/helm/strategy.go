@@ -0,0 +1,240 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// UpdateStrategy is one of UpdateStrategies.
+type UpdateStrategy string
+
+// UpdateStrategies enumerates available UpdateStrategy.
+var UpdateStrategies = struct {
+	// Pin replaces the version or constraint of the dependency with the exact new version.
+	Pin UpdateStrategy
+	// PreserveRange moves the constraint forward to the new version, keeping its operators and granularity.
+	// For example ~1.2.0 becomes ~1.4.0 .
+	PreserveRange UpdateStrategy
+	// Widen keeps the constraint and adds the moved constraint as an alternative.
+	// For example ~1.2.0 becomes ~1.2.0 || ~1.4.0 .
+	Widen UpdateStrategy
+}{
+	"pin",
+	"preserve-range",
+	"widen",
+}
+
+// ParseUpdateStrategy returns the UpdateStrategy with the given name or an error.
+func ParseUpdateStrategy(name string) (UpdateStrategy, error) {
+	switch s := UpdateStrategy(normalizeString(name)); s {
+	case UpdateStrategies.Pin, UpdateStrategies.PreserveRange, UpdateStrategies.Widen:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid update strategy %q, must be one of %s, %s, %s",
+		name, UpdateStrategies.Pin, UpdateStrategies.PreserveRange, UpdateStrategies.Widen)
+}
+
+// apply returns the version or constraint a dependency declaring the given constraint should be updated to.
+func (s UpdateStrategy) apply(constraint string, version *semver.Version) (string, error) {
+	switch s {
+	case UpdateStrategies.PreserveRange:
+		return preserveRange(constraint, version)
+
+	case UpdateStrategies.Widen:
+		c, err := semver.NewConstraint(constraint)
+		if err != nil {
+			return "", err
+		}
+		if c.Check(version) {
+			return constraint, nil
+		}
+
+		groups := strings.Split(constraint, "||")
+		moved, err := preserveRange(strings.TrimSpace(groups[len(groups)-1]), version)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(constraint) + " || " + moved, nil
+	}
+
+	return version.String(), nil
+}
+
+var (
+	// comparatorRegex matches a single comparison of a constraint like >=1.2.0 or ~1.2.x .
+	comparatorRegex = regexp.MustCompile(
+		`(!=|>=|=>|<=|=<|~>|>|<|=|~|\^)?\s*` +
+			`(v?(?:[0-9]+|[xX*])(?:\.(?:[0-9]+|[xX*]))?(?:\.(?:[0-9]+|[xX*]))?(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?)`,
+	)
+
+	// hyphenRangeRegex matches the separator of a hyphen range like 1.2 - 1.4.5 .
+	hyphenRangeRegex = regexp.MustCompile(`^\s+-\s+$`)
+)
+
+// preserveRange moves the last alternative of the constraint forward, so that it is satisfied by the given version.
+// Lower bounds and anchors like the version of a tilde or caret range are set to the version, keeping their
+// granularity and wildcards. Upper bounds are only raised if they exclude the version.
+func preserveRange(constraint string, version *semver.Version) (string, error) {
+	start := strings.LastIndex(constraint, "||")
+	if start < 0 {
+		start = 0
+	} else {
+		start += len("||")
+	}
+
+	var (
+		buf     strings.Builder
+		last    = start
+		matches = comparatorRegex.FindAllStringSubmatchIndex(constraint[start:], -1)
+	)
+	buf.WriteString(constraint[:start])
+
+	for i, m := range matches {
+		op := ""
+		if m[2] >= 0 {
+			op = constraint[start+m[2] : start+m[3]]
+		}
+		verStart, verEnd := start+m[4], start+m[5]
+		orig := constraint[verStart:verEnd]
+
+		// The upper version of a hyphen range is an inclusive upper bound, the lower one is an anchor.
+		if op == "" && i > 0 && hyphenRangeRegex.MatchString(constraint[start+matches[i-1][1]:verStart]) {
+			op = "<="
+		}
+
+		newVersion, err := moveComparator(op, orig, version)
+		if err != nil {
+			return "", err
+		}
+
+		buf.WriteString(constraint[last:verStart])
+		buf.WriteString(newVersion)
+		last = verEnd
+	}
+	buf.WriteString(constraint[last:])
+
+	result := buf.String()
+	c, err := semver.NewConstraint(result)
+	if err != nil {
+		return "", err
+	}
+	if !c.Check(version) {
+		return "", fmt.Errorf("cannot move constraint %q to version %s", constraint, version.String())
+	}
+	return result, nil
+}
+
+// moveComparator returns the version of the comparison with the given operator moved to the new version.
+func moveComparator(op, orig string, version *semver.Version) (string, error) {
+	switch op {
+	case "!=", ">":
+		// Exclusions and exclusive lower bounds cannot be moved to the version, they remain untouched.
+		return orig, nil
+
+	case "<", "<=", "=<":
+		c, err := semver.NewConstraint(op + orig)
+		if err != nil {
+			return "", err
+		}
+		if c.Check(version) {
+			return orig, nil
+		}
+		if op == "<" {
+			return nextUpperBound(orig, version), nil
+		}
+		return formatLike(orig, version), nil
+	}
+
+	// Exact versions, x-ranges and the anchors of >=, ~, ~> and ^ are set to the new version.
+	return formatLike(orig, version), nil
+}
+
+// formatLike formats the version like the original one, keeping the v prefix, the number of segments and wildcards.
+func formatLike(orig string, version *semver.Version) string {
+	prefix := ""
+	if strings.HasPrefix(orig, "v") {
+		prefix = "v"
+	}
+
+	segments := versionSegments(orig)
+	newSegments := []uint64{version.Major(), version.Minor(), version.Patch()}
+	for i, s := range segments {
+		if !isWildcard(s) {
+			segments[i] = strconv.FormatUint(newSegments[i], 10)
+		}
+	}
+
+	res := prefix + strings.Join(segments, ".")
+	if len(segments) == 3 && !isWildcard(segments[2]) && version.Prerelease() != "" {
+		res += "-" + version.Prerelease()
+	}
+	return res
+}
+
+// nextUpperBound returns an exclusive upper bound for the version with the same granularity as the original one.
+// For example the bound <2.0.0 becomes <3.0.0 for version 2.4.1 while <1.5.0 becomes <2.5.0 .
+func nextUpperBound(orig string, version *semver.Version) string {
+	prefix := ""
+	if strings.HasPrefix(orig, "v") {
+		prefix = "v"
+	}
+
+	segments := versionSegments(orig)
+
+	// The least significant non-zero segment of the bound determines which segment is incremented.
+	idx := 0
+	for i, s := range segments {
+		if s != "0" && !isWildcard(s) {
+			idx = i
+		}
+	}
+
+	newSegments := []uint64{version.Major(), version.Minor(), version.Patch()}
+	for i := range segments {
+		switch {
+		case i < idx:
+			segments[i] = strconv.FormatUint(newSegments[i], 10)
+		case i == idx:
+			segments[i] = strconv.FormatUint(newSegments[i]+1, 10)
+		default:
+			segments[i] = "0"
+		}
+	}
+	return prefix + strings.Join(segments, ".")
+}
+
+// versionSegments returns the major, minor and patch segments of the version as declared.
+func versionSegments(v string) []string {
+	v = strings.TrimPrefix(v, "v")
+	if idx := strings.IndexAny(v, "-+"); idx >= 0 {
+		v = v[:idx]
+	}
+	return strings.Split(v, ".")
+}
+
+func isWildcard(segment string) bool {
+	return segment == "x" || segment == "X" || segment == "*"
+}
@@ -0,0 +1,122 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateStrategies(t *testing.T) {
+	tests := []struct {
+		constraint,
+		version,
+		expectedPin,
+		expectedPreserveRange,
+		expectedWiden string
+	}{
+		// Exact versions.
+		{"1.2.0", "1.4.0", "1.4.0", "1.4.0", "1.2.0 || 1.4.0"},
+		{"v1.2.0", "1.4.0", "1.4.0", "v1.4.0", "v1.2.0 || v1.4.0"},
+		{"=1.2.0", "1.4.0", "1.4.0", "=1.4.0", "=1.2.0 || =1.4.0"},
+		// Tilde and caret ranges.
+		{"~1.2.0", "1.4.0", "1.4.0", "~1.4.0", "~1.2.0 || ~1.4.0"},
+		{"~1.2", "1.4.3", "1.4.3", "~1.4", "~1.2 || ~1.4"},
+		{"~>1.2.0", "1.4.0", "1.4.0", "~>1.4.0", "~>1.2.0 || ~>1.4.0"},
+		{"^2.1", "3.0.2", "3.0.2", "^3.0", "^2.1 || ^3.0"},
+		{"^1.2.0", "1.4.0", "1.4.0", "^1.4.0", "^1.2.0"},
+		// X-ranges.
+		{"1.2.x", "1.4.1", "1.4.1", "1.4.x", "1.2.x || 1.4.x"},
+		{"1.*", "2.1.0", "2.1.0", "2.*", "1.* || 2.*"},
+		{"*", "2.1.0", "2.1.0", "*", "*"},
+		// Lower bounds.
+		{">=1.2.0", "1.4.0", "1.4.0", ">=1.4.0", ">=1.2.0"},
+		{"=>1.2", "1.4.0", "1.4.0", "=>1.4", "=>1.2"},
+		{">1.2.0", "1.4.0", "1.4.0", ">1.2.0", ">1.2.0"},
+		// Upper bounds.
+		{"<2.0.0", "2.1.3", "2.1.3", "<3.0.0", "<2.0.0 || <3.0.0"},
+		{"<1.5", "1.7.0", "1.7.0", "<1.8", "<1.5 || <1.8"},
+		{"<=1.4.5", "1.5.0", "1.5.0", "<=1.5.0", "<=1.4.5 || <=1.5.0"},
+		{"=<1.4", "1.5.2", "1.5.2", "=<1.5", "=<1.4 || =<1.5"},
+		// Exclusions.
+		{"!=1.3.0", "1.4.0", "1.4.0", "!=1.3.0", "!=1.3.0"},
+		// Combinations.
+		{">=1.2.0 <2.0.0", "2.1.3", "2.1.3", ">=2.1.3 <3.0.0", ">=1.2.0 <2.0.0 || >=2.1.3 <3.0.0"},
+		{">= 1.2, < 1.5", "1.7.0", "1.7.0", ">= 1.7, < 1.8", ">= 1.2, < 1.5 || >= 1.7, < 1.8"},
+		{">1.2.0, !=1.3.0, <1.4.0", "1.4.2", "1.4.2", ">1.2.0, !=1.3.0, <1.5.0", ">1.2.0, !=1.3.0, <1.4.0 || >1.2.0, !=1.3.0, <1.5.0"},
+		{"1.2 - 1.4.5", "2.0.1", "2.0.1", "2.0 - 2.0.1", "1.2 - 1.4.5 || 2.0 - 2.0.1"},
+		{"^1.0 || ^2.0", "3.1.0", "3.1.0", "^1.0 || ^3.1", "^1.0 || ^2.0 || ^3.1"},
+		// Pre-releases.
+		{"~1.2.0-rc.1", "1.2.0-rc.2", "1.2.0-rc.2", "~1.2.0-rc.2", "~1.2.0-rc.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			version := semver.MustParse(tt.version)
+
+			for strategy, expected := range map[UpdateStrategy]string{
+				UpdateStrategies.Pin:           tt.expectedPin,
+				UpdateStrategies.PreserveRange: tt.expectedPreserveRange,
+				UpdateStrategies.Widen:         tt.expectedWiden,
+			} {
+				actual, err := strategy.apply(tt.constraint, version)
+				require.NoError(t, err, "there should be no error applying the strategy %s", strategy)
+				assert.Equal(t, expected, actual, "strategy %s", strategy)
+
+				c, err := semver.NewConstraint(actual)
+				require.NoError(t, err, "the result of the strategy %s must be a valid constraint", strategy)
+				assert.True(t, c.Check(version), "the result of the strategy %s must be satisfied by the new version", strategy)
+			}
+		})
+	}
+}
+
+func TestUpdateStrategyUnsatisfiable(t *testing.T) {
+	_, err := UpdateStrategies.PreserveRange.apply("!=1.4.0", semver.MustParse("1.4.0"))
+	assert.Error(t, err, "a constraint excluding the new version cannot be preserved")
+}
+
+func TestParseUpdateStrategy(t *testing.T) {
+	s, err := ParseUpdateStrategy("Preserve-Range")
+	assert.NoError(t, err, "the strategy should be parsed case insensitive")
+	assert.Equal(t, UpdateStrategies.PreserveRange, s)
+
+	_, err = ParseUpdateStrategy("latest")
+	assert.Error(t, err, "an unknown strategy should be rejected")
+}
+
+func TestUpdateDependenciesPreserveRange(t *testing.T) {
+	chartPath := copyFixtureChart(t, "chart-v2")
+
+	r := newOutdatedResult("testdependency", "0.0.1", "0.3.2")
+	r.Version = "~0.0.1"
+	plan := &Plan{ChartPath: chartPath, Updates: []*Result{r}, Strategy: UpdateStrategies.PreserveRange}
+	require.NoError(t, NewChecker(Options{}).Apply(context.Background(), plan), "there should be no error updating the dependencies")
+
+	data, err := ioutil.ReadFile(filepath.Join(chartPath, chartMetadataName))
+	require.NoError(t, err, "there must be no error reading the Chart.yaml")
+	assert.Contains(t, string(data), "version: ~0.3.2", "the constraint should have been moved")
+}
@@ -0,0 +1,134 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// DefaultCommitMessageTemplate is the template of the commit message of updated dependencies.
+const DefaultCommitMessageTemplate = `[{{ .Chart.Name }}] updated dependency to {{ range $i, $r := .Results }}{{ if $i }}, {{ end }}{{ default $r.Name $r.Alias }}@{{ $r.LatestVersion }}{{ end }}`
+
+// DefaultPullRequestTitleTemplate is the template of the title of pull requests for updated dependencies.
+const DefaultPullRequestTitleTemplate = `[{{ .Chart.Name }}] updating dependencies`
+
+// Template renders results using a Go text/template with the functions of sprig.
+// It is executed with TemplateData.
+type Template struct {
+	tmpl *template.Template
+}
+
+// TemplateData is the data a Template is executed with.
+type TemplateData struct {
+	// Chart is the metadata of the checked chart, e.g. {{ .Chart.Name }} .
+	Chart *chart.Metadata
+	// ChartPath is the path of the checked chart.
+	ChartPath string
+	// Results are the results of the dependencies.
+	Results []*TemplateResult
+	// Bump is the largest change from the current to the latest version of the results or empty if there is none.
+	Bump IncType
+}
+
+// TemplateResult is a Result with its bump, e.g. {{ .Name }} {{ .CurrentVersion }} {{ .LatestVersion }} {{ .Bump }} .
+type TemplateResult struct {
+	*Result
+	// Bump is the change from the current to the latest version. It is empty if the latest version is unknown.
+	Bump IncType
+}
+
+// ParseTemplate parses the given text as template.
+func ParseTemplate(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).Funcs(sprig.TxtFuncMap()).Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid template")
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+// LoadTemplate parses the template in the file with the given path. If there is no such file, the value itself is
+// parsed as template, which must contain an action like {{ .Results }}. Otherwise a mistyped path would be rendered
+// as text.
+func LoadTemplate(value string) (*Template, error) {
+	if info, err := os.Stat(value); err == nil && !info.IsDir() {
+		text, err := ioutil.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+		return ParseTemplate(filepath.Base(value), string(text))
+	}
+	if !strings.Contains(value, "{{") {
+		return nil, errors.Errorf("template file %s not found, inline templates must contain {{", value)
+	}
+	return ParseTemplate("template", value)
+}
+
+// Execute renders the results of the chart in the given path.
+func (t *Template) Execute(w io.Writer, chartPath string, results []*Result) error {
+	data, err := newTemplateData(chartPath, results)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(t.tmpl.Execute(w, data), "failed to render template")
+}
+
+// Render returns the rendered results of the chart in the given path.
+func (t *Template) Render(chartPath string, results []*Result) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, chartPath, results); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func newTemplateData(chartPath string, results []*Result) (*TemplateData, error) {
+	c, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &TemplateData{
+		Chart:     c.Metadata,
+		ChartPath: chartPath,
+		Results:   []*TemplateResult{},
+	}
+	for _, r := range results {
+		tr := &TemplateResult{Result: r}
+		if r.LatestVersion != nil {
+			tr.Bump = GetIncType(r.CurrentVersion, r.LatestVersion)
+			if data.Bump == "" || data.Bump == IncTypes.None || (tr.Bump != IncTypes.None && data.Bump.IsGreater(tr.Bump)) {
+				data.Bump = tr.Bump
+			}
+		}
+		data.Results = append(data.Results, tr)
+	}
+	return data, nil
+}
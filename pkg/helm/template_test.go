@@ -0,0 +1,88 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateOutput(t *testing.T) {
+	chartPath, results := newTestOutputResults()
+	tmpl, err := LoadTemplate(filepath.Join("fixtures", "output", "results.tmpl"))
+	require.NoError(t, err, "there should be no error loading the template file")
+
+	var buf bytes.Buffer
+	err = WriteOutput(&buf, OutputFormats.Template, chartPath, results, OutputOptions{Template: tmpl})
+	require.NoError(t, err, "there should be no error rendering the template")
+	assertGolden(t, "results.template.txt", buf.Bytes())
+
+	err = WriteOutput(&buf, OutputFormats.Template, chartPath, results, OutputOptions{})
+	assert.Error(t, err, "the template output requires a template")
+}
+
+func TestLoadInlineTemplate(t *testing.T) {
+	chartPath, results := newTestOutputResults()
+
+	tmpl, err := LoadTemplate(`{{ len .Results }} dependencies of {{ .ChartPath | base }}`)
+	require.NoError(t, err, "there should be no error parsing an inline template")
+	res, err := tmpl.Render(chartPath, results)
+	require.NoError(t, err, "there should be no error rendering the template")
+	assert.Equal(t, "3 dependencies of chart-v2", res)
+
+	_, err = LoadTemplate(`{{ .Results `)
+	assert.Error(t, err, "an invalid template should be rejected")
+
+	_, err = LoadTemplate(filepath.Join("fixtures", "output", "missing.tmpl"))
+	assert.Error(t, err, "a missing template file should not be parsed as inline template")
+
+	tmpl, err = LoadTemplate(`{{ .Unknown }}`)
+	require.NoError(t, err, "there should be no error parsing the template")
+	_, err = tmpl.Render(chartPath, results)
+	assert.Error(t, err, "unknown fields should fail to render")
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	chartPath, _ := newTestOutputResults()
+	minor := newOutdatedResult("minor", "1.0.0", "1.1.0")
+	patch := newOutdatedResult("patch", "1.0.0", "1.0.1")
+	patch.Alias = "aliased"
+	results := []*Result{minor, patch}
+
+	tmpl, err := ParseTemplate("commit", DefaultCommitMessageTemplate)
+	require.NoError(t, err, "there should be no error parsing the default commit message template")
+	msg, err := tmpl.Render(chartPath, results)
+	require.NoError(t, err, "there should be no error rendering the commit message")
+	assert.Equal(t, "[chart-v2] updated dependency to minor@1.1.0, aliased@1.0.1", msg)
+
+	tmpl, err = ParseTemplate("title", DefaultPullRequestTitleTemplate)
+	require.NoError(t, err, "there should be no error parsing the default pull request title template")
+	title, err := tmpl.Render(chartPath, results)
+	require.NoError(t, err, "there should be no error rendering the pull request title")
+	assert.Equal(t, "[chart-v2] updating dependencies", title)
+
+	data, err := newTemplateData(chartPath, results)
+	require.NoError(t, err, "there should be no error creating the template data")
+	assert.Equal(t, IncTypes.Minor, data.Bump, "the largest bump should be provided")
+}
@@ -0,0 +1,226 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// File system operations used by the fileTransaction. Replaced in tests to inject failures.
+var (
+	renameFile = os.Rename
+	removeFile = os.Remove
+	syncFile   = func(f *os.File) error { return f.Sync() }
+)
+
+// fileTransaction writes a set of files either completely or not at all.
+// Each file is written to a temporary file in the same directory, synced to disk and renamed over the original,
+// so a crash never leaves a partially written file behind. If replacing one of the files fails,
+// the files replaced so far are restored.
+type fileTransaction struct {
+	files []*stagedFile
+}
+
+// RollbackError is returned if writing the files of a transaction failed and some of the files replaced so far could
+// not be restored. These files are left with their new content.
+type RollbackError struct {
+	// Err is the error which caused the rollback.
+	Err error
+	// Failures are the errors restoring the files.
+	Failures []error
+}
+
+// Error implements the error interface.
+func (e *RollbackError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, err := range e.Failures {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%s, rollback failed: %s", e.Err, strings.Join(msgs, ", "))
+}
+
+// Cause returns the error which caused the rollback.
+func (e *RollbackError) Cause() error {
+	return e.Err
+}
+
+type stagedFile struct {
+	path,
+	tmpPath string
+	data,
+	original []byte
+	mode os.FileMode
+	exists,
+	replaced bool
+}
+
+// Stage adds the file with the given content to the transaction.
+// Staging the same file again replaces the previously staged content.
+func (t *fileTransaction) Stage(path string, data []byte) {
+	for _, f := range t.files {
+		if f.path == path {
+			f.data = data
+			return
+		}
+	}
+	t.files = append(t.files, &stagedFile{path: path, data: data, mode: 0644})
+}
+
+// Commit writes all staged files.
+func (t *fileTransaction) Commit() error {
+	defer t.cleanup()
+
+	for _, f := range t.files {
+		if err := f.prepare(); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range t.files {
+		if err := renameFile(f.tmpPath, f.path); err != nil {
+			err = errors.Wrapf(err, "failed to replace %s", f.path)
+			if failures := t.rollback(); len(failures) > 0 {
+				return &RollbackError{Err: err, Failures: failures}
+			}
+			return err
+		}
+		f.tmpPath = ""
+		f.replaced = true
+	}
+
+	for _, dir := range t.dirs() {
+		syncDir(dir)
+	}
+
+	return nil
+}
+
+// prepare reads the original content of the file and writes the new content to a temporary file.
+func (f *stagedFile) prepare() error {
+	if fi, err := os.Stat(f.path); err == nil {
+		f.mode = fi.Mode().Perm()
+		f.original, err = ioutil.ReadFile(f.path)
+		if err != nil {
+			return err
+		}
+		f.exists = true
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	tmpPath, err := writeTempFile(f.path, f.data, f.mode)
+	f.tmpPath = tmpPath
+	return err
+}
+
+// rollback restores the original content of all files replaced so far and returns the errors for files which could
+// not be restored.
+func (t *fileTransaction) rollback() []error {
+	var failures []error
+	for _, f := range t.files {
+		if !f.replaced {
+			continue
+		}
+
+		if !f.exists {
+			if err := removeFile(f.path); err != nil {
+				failures = append(failures, errors.Wrapf(err, "failed to remove %s", f.path))
+			}
+			continue
+		}
+
+		tmpPath, err := writeTempFile(f.path, f.original, f.mode)
+		if err == nil {
+			err = renameFile(tmpPath, f.path)
+		}
+		if err != nil {
+			os.Remove(tmpPath)
+			failures = append(failures, errors.Wrapf(err, "failed to restore %s", f.path))
+		}
+	}
+	return failures
+}
+
+// cleanup removes temporary files which were not renamed.
+func (t *fileTransaction) cleanup() {
+	for _, f := range t.files {
+		if f.tmpPath != "" {
+			os.Remove(f.tmpPath)
+			f.tmpPath = ""
+		}
+	}
+}
+
+func (t *fileTransaction) dirs() []string {
+	var (
+		dirs []string
+		seen = map[string]bool{}
+	)
+	for _, f := range t.files {
+		if dir := filepath.Dir(f.path); !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// writeTempFile writes the data to a new temporary file next to the given path and syncs it to disk.
+// The path of the temporary file is returned even in case of an error, so it can be removed.
+func writeTempFile(path string, data []byte, mode os.FileMode) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return "", err
+	}
+	tmpPath := f.Name()
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return tmpPath, err
+	}
+
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return tmpPath, err
+	}
+
+	if err := syncFile(f); err != nil {
+		f.Close()
+		return tmpPath, errors.Wrapf(err, "failed to sync %s", tmpPath)
+	}
+
+	return tmpPath, f.Close()
+}
+
+// syncDir persists the renames in the directory. Not every platform supports this, hence errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	d.Sync()
+}
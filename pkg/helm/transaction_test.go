@@ -0,0 +1,194 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errInjected = errors.New("injected failure")
+
+// readDir returns the content of all files in the given directory by name.
+func readDir(t *testing.T, dir string) map[string]string {
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err, "there must be no error reading the directory")
+
+	content := map[string]string{}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		require.NoError(t, err, "there must be no error reading %s", f.Name())
+		content[f.Name()] = string(data)
+	}
+	return content
+}
+
+// failOnCall returns a function which returns an error on the n-th call.
+func failOnCall(n int) func() error {
+	calls := 0
+	return func() error {
+		calls++
+		if calls == n {
+			return errInjected
+		}
+		return nil
+	}
+}
+
+func TestFileTransactionCommit(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.yaml")
+	require.NoError(t, ioutil.WriteFile(existing, []byte("a very long original content\n"), 0600), "there must be no error writing the file")
+
+	tx := &fileTransaction{}
+	tx.Stage(existing, []byte("short\n"))
+	tx.Stage(filepath.Join(dir, "new.yaml"), []byte("new\n"))
+	require.NoError(t, tx.Commit(), "there should be no error committing the transaction")
+
+	assert.Equal(t, map[string]string{"existing.yaml": "short\n", "new.yaml": "new\n"}, readDir(t, dir), "the files should have been replaced without leftovers")
+
+	fi, err := os.Stat(existing)
+	require.NoError(t, err, "there must be no error reading the file info")
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "the file mode of the existing file should be kept")
+}
+
+func TestChartWriterRollback(t *testing.T) {
+	tests := []struct {
+		name   string
+		inject func()
+	}{
+		{
+			name: "sync of first file fails",
+			inject: func() {
+				fail := failOnCall(1)
+				syncFile = func(f *os.File) error {
+					if err := fail(); err != nil {
+						return err
+					}
+					return f.Sync()
+				}
+			},
+		},
+		{
+			name: "sync of second file fails",
+			inject: func() {
+				fail := failOnCall(2)
+				syncFile = func(f *os.File) error {
+					if err := fail(); err != nil {
+						return err
+					}
+					return f.Sync()
+				}
+			},
+		},
+		{
+			name: "rename of first file fails",
+			inject: func() {
+				fail := failOnCall(1)
+				renameFile = func(oldpath, newpath string) error {
+					if err := fail(); err != nil {
+						return err
+					}
+					return os.Rename(oldpath, newpath)
+				}
+			},
+		},
+		{
+			name: "rename of second file fails",
+			inject: func() {
+				fail := failOnCall(2)
+				renameFile = func(oldpath, newpath string) error {
+					if err := fail(); err != nil {
+						return err
+					}
+					return os.Rename(oldpath, newpath)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(rename func(string, string) error, sync func(*os.File) error) {
+				renameFile, syncFile = rename, sync
+			}(renameFile, syncFile)
+
+			chartPath := copyFixtureChart(t, "chart-v1")
+			before := readDir(t, chartPath)
+
+			w, err := NewChartWriter(chartPath)
+			require.NoError(t, err, "there must be no error creating the chart writer")
+			require.NoError(t, w.IncrementChartVersion(IncTypes.Patch), "there should be no error incrementing the chart version")
+			require.NoError(t, w.UpdateDependencies([]*Result{newOutdatedResult("testdependency", "0.0.1", "0.1.0")}, UpdateStrategies.Pin), "there should be no error updating the dependencies")
+
+			tt.inject()
+			assert.Error(t, w.Commit(), "the injected failure should be returned")
+			assert.Equal(t, before, readDir(t, chartPath), "all files of the chart should be unchanged")
+		})
+	}
+}
+
+func TestChartWriterCommitRollbackFails(t *testing.T) {
+	defer func(rename func(string, string) error) { renameFile = rename }(renameFile)
+
+	chartPath := copyFixtureChart(t, "chart-v1")
+	w, err := NewChartWriter(chartPath)
+	require.NoError(t, err, "there must be no error creating the chart writer")
+	require.NoError(t, w.IncrementChartVersion(IncTypes.Patch), "there should be no error incrementing the chart version")
+	require.NoError(t, w.UpdateDependencies([]*Result{newOutdatedResult("testdependency", "0.0.1", "0.1.0")}, UpdateStrategies.Pin), "there should be no error updating the dependencies")
+
+	// The first file is replaced, replacing the second one and restoring the first one fail.
+	calls := 0
+	renameFile = func(oldpath, newpath string) error {
+		calls++
+		if calls > 1 {
+			return errInjected
+		}
+		return os.Rename(oldpath, newpath)
+	}
+
+	err = w.Commit()
+	require.Error(t, err, "the injected failure should be returned")
+	assert.Contains(t, err.Error(), "some files were changed", "the error should not claim that no changes were applied")
+	assert.Contains(t, err.Error(), "rollback failed: failed to restore", "the error should contain the rollback failure")
+	assert.Equal(t, errInjected, pkgerrors.Cause(err), "the cause should be the injected failure")
+}
+
+func TestChartWriterCommit(t *testing.T) {
+	chartPath := copyFixtureChart(t, "chart-v1")
+
+	w, err := NewChartWriter(chartPath)
+	require.NoError(t, err, "there must be no error creating the chart writer")
+	require.NoError(t, w.IncrementChartVersion(IncTypes.Patch), "there should be no error incrementing the chart version")
+	require.NoError(t, w.UpdateDependencies([]*Result{newOutdatedResult("testdependency", "0.0.1", "0.1.0")}, UpdateStrategies.Pin), "there should be no error updating the dependencies")
+	require.NoError(t, w.Commit(), "there should be no error committing the changes")
+
+	files := readDir(t, chartPath)
+	assert.Len(t, files, 2, "no temporary files should be left behind")
+	assert.Contains(t, files[chartMetadataName], "version: 0.1.1", "the chart version should have been incremented")
+	assert.Contains(t, files[requirementsName], "version: 0.1.0", "the dependency should have been updated")
+}
@@ -25,7 +25,7 @@ import (
 
     "net/url"
 
-	"github.com/Masterminds/semver"
+	"github.com/Masterminds/semver/v3"
 	"helm.sh/helm/v3/pkg/chart"
 )
 
@@ -47,6 +47,17 @@ func normalizeRepoName(repoURL string) string {
 	return strings.ReplaceAll(name, ".", "-")
 }
 
+// joinNonEmpty joins the non-empty strings using the separator.
+func joinNonEmpty(sep string, s ...string) string {
+	var res []string
+	for _, str := range s {
+		if str != "" {
+			res = append(res, str)
+		}
+	}
+	return strings.Join(res, sep)
+}
+
 func normalizeString(theString string) string {
 	theString = strings.TrimSpace(theString)
 	return strings.ToLower(theString)
@@ -19,7 +19,11 @@
 
 package helm
 
-import "github.com/Masterminds/semver"
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+)
 
 // IncType is one of IncTypes.
 type IncType string
@@ -37,6 +41,15 @@ var IncTypes = struct {
 	"none",
 }
 
+// ParseIncType returns the IncType with the given name or an error.
+func ParseIncType(name string) (IncType, error) {
+	switch i := IncType(normalizeString(name)); i {
+	case IncTypes.Major, IncTypes.Minor, IncTypes.Patch:
+		return i, nil
+	}
+	return "", fmt.Errorf("invalid version increment %q, must be one of %s, %s, %s", name, IncTypes.Patch, IncTypes.Minor, IncTypes.Major)
+}
+
 // IsGreater check whether the given IncType is greater.
 func (i IncType) IsGreater(inc IncType) bool {
 	switch i {
@@ -49,7 +62,12 @@ func (i IncType) IsGreater(inc IncType) bool {
 }
 
 // GetIncType returns IncType based on which segment of the Version was changed.
+// Without an old version, for example if no version satisfies a constraint, a major change is assumed.
 func GetIncType(oldVersion, newVersion *semver.Version) IncType {
+	if oldVersion == nil {
+		return IncTypes.Major
+	}
+
 	if newVersion.Major() > oldVersion.Major() {
 		return IncTypes.Major
 	}
@@ -0,0 +1,267 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlDocument is a YAML file that can be edited without losing comments, key order, indentation or quoting.
+// Instead of encoding the whole document again, only the raw text of the changed scalars is replaced.
+type yamlDocument struct {
+	data []byte
+	root *yaml.Node
+}
+
+// newYAMLDocument parses the given YAML data.
+func newYAMLDocument(data []byte) (*yamlDocument, error) {
+	d := &yamlDocument{}
+	if err := d.parse(data); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Bytes returns the current content of the document.
+func (d *yamlDocument) Bytes() []byte {
+	return d.data
+}
+
+// SetChartVersion sets the top level version of a Chart.yaml.
+func (d *yamlDocument) SetChartVersion(version string) error {
+	root, err := d.rootMapping()
+	if err != nil {
+		return err
+	}
+
+	node := mappingValue(root, "version")
+	if node == nil {
+		return errors.New("chart has no version")
+	}
+	return d.setScalar(node, version)
+}
+
+// SetDependencyVersion sets the version of the dependency identified by its name and alias.
+func (d *yamlDocument) SetDependencyVersion(name, alias, version string) error {
+	return d.setDependencyField(name, alias, "version", version)
+}
+
+// SetDependencyRepository sets the repository of the dependency identified by its name and alias.
+func (d *yamlDocument) SetDependencyRepository(name, alias, repository string) error {
+	return d.setDependencyField(name, alias, "repository", repository)
+}
+
+// DependencyPosition returns the line and column of the version of the dependency identified by its name and alias.
+// The position of the dependency itself is returned if it declares no version.
+func (d *yamlDocument) DependencyPosition(name, alias string) (int, int, error) {
+	dep, err := d.findDependency(name, alias)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if node := mappingValue(dep, "version"); node != nil {
+		return node.Line, node.Column, nil
+	}
+	return dep.Line, dep.Column, nil
+}
+
+func (d *yamlDocument) setDependencyField(name, alias, key, value string) error {
+	dep, err := d.findDependency(name, alias)
+	if err != nil {
+		return err
+	}
+
+	node := mappingValue(dep, key)
+	if node == nil {
+		return fmt.Errorf("dependency %s has no %s", name, key)
+	}
+	return d.setScalar(node, value)
+}
+
+func (d *yamlDocument) parse(data []byte) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	d.data = data
+	d.root = &root
+	return nil
+}
+
+func (d *yamlDocument) rootMapping() (*yaml.Node, error) {
+	if d.root.Kind != yaml.DocumentNode || len(d.root.Content) == 0 || d.root.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("document is not a YAML mapping")
+	}
+	return d.root.Content[0], nil
+}
+
+func (d *yamlDocument) findDependency(name, alias string) (*yaml.Node, error) {
+	root, err := d.rootMapping()
+	if err != nil {
+		return nil, err
+	}
+
+	deps := mappingValue(root, "dependencies")
+	if deps == nil || deps.Kind != yaml.SequenceNode {
+		return nil, errors.New("document has no dependencies")
+	}
+
+	for _, dep := range deps.Content {
+		if dep.Kind != yaml.MappingNode {
+			continue
+		}
+		if scalarValue(mappingValue(dep, "name")) == name && scalarValue(mappingValue(dep, "alias")) == alias {
+			return dep, nil
+		}
+	}
+	return nil, fmt.Errorf("dependency %s not found", name)
+}
+
+// setScalar replaces the raw text of the given scalar node and parses the document again, so that the positions
+// of all nodes remain valid for subsequent edits.
+func (d *yamlDocument) setScalar(node *yaml.Node, value string) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: expected a scalar value", node.Line)
+	}
+	if node.Value == value {
+		return nil
+	}
+
+	start, err := d.offset(node.Line, node.Column)
+	if err != nil {
+		return err
+	}
+
+	end, err := d.scalarEnd(node, start)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(d.data) + len(value))
+	buf.Write(d.data[:start])
+	buf.WriteString(quoteScalar(value, node.Style))
+	buf.Write(d.data[end:])
+
+	return d.parse(buf.Bytes())
+}
+
+// offset converts a line and column as reported by the YAML parser to a byte offset in the document.
+func (d *yamlDocument) offset(line, column int) (int, error) {
+	offset := 0
+	for l := 1; l < line; l++ {
+		idx := bytes.IndexByte(d.data[offset:], '\n')
+		if idx < 0 {
+			return 0, fmt.Errorf("line %d is out of range", line)
+		}
+		offset += idx + 1
+	}
+
+	// Columns are counted in characters, not bytes.
+	for c := 1; c < column; c++ {
+		if offset >= len(d.data) {
+			return 0, fmt.Errorf("line %d: column %d is out of range", line, column)
+		}
+		_, size := utf8.DecodeRune(d.data[offset:])
+		offset += size
+	}
+	return offset, nil
+}
+
+// scalarEnd returns the byte offset after the raw text of the scalar starting at the given offset.
+func (d *yamlDocument) scalarEnd(node *yaml.Node, start int) (int, error) {
+	switch {
+	case node.Style&yaml.DoubleQuotedStyle != 0:
+		for i := start + 1; i < len(d.data); i++ {
+			switch d.data[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1, nil
+			}
+		}
+	case node.Style&yaml.SingleQuotedStyle != 0:
+		for i := start + 1; i < len(d.data); i++ {
+			if d.data[i] == '\'' {
+				if i+1 < len(d.data) && d.data[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1, nil
+			}
+		}
+	case node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		return 0, fmt.Errorf("line %d: block scalars are not supported", node.Line)
+	default:
+		if bytes.HasPrefix(d.data[start:], []byte(node.Value)) {
+			return start + len(node.Value), nil
+		}
+		return 0, fmt.Errorf("line %d: multi-line plain scalars are not supported", node.Line)
+	}
+	return 0, fmt.Errorf("line %d: unterminated quoted scalar", node.Line)
+}
+
+// quoteScalar renders the value in the given style.
+// Plain values that would not be read back as the same string are double quoted.
+func quoteScalar(value string, style yaml.Style) string {
+	switch {
+	case style&yaml.SingleQuotedStyle != 0:
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	case style&yaml.DoubleQuotedStyle != 0 || !isPlainSafe(value):
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+	}
+	return value
+}
+
+// isPlainSafe checks whether the value can be written as a plain scalar and is read back as the same string.
+func isPlainSafe(value string) bool {
+	var n yaml.Node
+	if err := yaml.Unmarshal([]byte("v: "+value), &n); err != nil {
+		return false
+	}
+	v := mappingValue(n.Content[0], "v")
+	return v != nil && v.Kind == yaml.ScalarNode && v.Tag == "!!str" && v.Style == 0 && v.Value == value
+}
+
+// mappingValue returns the value of the given key in the mapping node or nil.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
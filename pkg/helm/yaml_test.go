@@ -0,0 +1,159 @@
+/*******************************************************************************
+*
+* Copyright 2019 SAP SE
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You should have received a copy of the License along with this
+* program. If not, you may obtain a copy of the License at
+*
+*     http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+*
+*******************************************************************************/
+
+package helm
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// changedLines returns the lines of the new text which differ from the old text.
+// Both texts must have the same number of lines.
+func changedLines(t *testing.T, oldText, newText string) []string {
+	oldLines := strings.Split(oldText, "\n")
+	newLines := strings.Split(newText, "\n")
+	require.Len(t, newLines, len(oldLines), "the number of lines must not change")
+
+	var changed []string
+	for i := range oldLines {
+		if oldLines[i] != newLines[i] {
+			changed = append(changed, newLines[i])
+		}
+	}
+	return changed
+}
+
+func TestYAMLDocumentPreservesFormatting(t *testing.T) {
+	chartPath := copyFixtureChart(t, "chart-formatted")
+	before, err := ioutil.ReadFile(filepath.Join(chartPath, chartMetadataName))
+	require.NoError(t, err, "there must be no error reading the Chart.yaml")
+
+	err = UpdateDependencies(chartPath, []*Result{
+		newOutdatedResult("exporter", "0.3.1", "0.4.0"),
+		newOutdatedResult("dashboards", "2.0.0", "2.1.0"),
+	}, 4)
+	require.NoError(t, err, "there should be no error updating the dependencies")
+
+	err = IncrementChartVersion(chartPath, IncTypes.Minor)
+	require.NoError(t, err, "there should be no error incrementing the chart version")
+
+	after, err := ioutil.ReadFile(filepath.Join(chartPath, chartMetadataName))
+	require.NoError(t, err, "there must be no error reading the Chart.yaml")
+
+	assert.Equal(t,
+		[]string{
+			`version: "1.5.0" # bumped by the release pipeline`,
+			`      version: '0.4.0'`,
+			`    - {name: dashboards, version: "2.1.0", repository: "https://repo.evil.corp"}`,
+		},
+		changedLines(t, string(before), string(after)),
+		"only the versions of the chart and the updated dependencies should have been changed",
+	)
+}
+
+func TestYAMLDocumentSetDependencyVersion(t *testing.T) {
+	tests := []struct {
+		name,
+		input,
+		dependency,
+		version,
+		expected string
+	}{
+		{
+			name:       "plain",
+			input:      "dependencies:\n- name: a\n  version: 1.0.0 # comment\n",
+			dependency: "a",
+			version:    "1.1.0",
+			expected:   "dependencies:\n- name: a\n  version: 1.1.0 # comment\n",
+		},
+		{
+			name:       "double quoted",
+			input:      "dependencies:\n- name: a\n  version: \"1.0.0\"\n",
+			dependency: "a",
+			version:    "1.1.0",
+			expected:   "dependencies:\n- name: a\n  version: \"1.1.0\"\n",
+		},
+		{
+			name:       "single quoted",
+			input:      "dependencies:\n- name: a\n  version: '1.0.0'\n",
+			dependency: "a",
+			version:    "1.1.0",
+			expected:   "dependencies:\n- name: a\n  version: '1.1.0'\n",
+		},
+		{
+			name:       "plain value that must be quoted",
+			input:      "dependencies:\n- name: a\n  version: 1.0.0\n",
+			dependency: "a",
+			version:    ">=1.1.0",
+			expected:   "dependencies:\n- name: a\n  version: \">=1.1.0\"\n",
+		},
+		{
+			name:       "non-ascii characters before the value",
+			input:      "dependencies:\n- {name: ä, version: 1.0.0}\n",
+			dependency: "ä",
+			version:    "1.1.0",
+			expected:   "dependencies:\n- {name: ä, version: 1.1.0}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := newYAMLDocument([]byte(tt.input))
+			require.NoError(t, err, "there must be no error parsing the document")
+
+			require.NoError(t, doc.SetDependencyVersion(tt.dependency, "", tt.version), "there should be no error setting the version")
+			assert.Equal(t, tt.expected, string(doc.Bytes()))
+		})
+	}
+}
+
+func TestYAMLDocumentUnknownDependency(t *testing.T) {
+	doc, err := newYAMLDocument([]byte("dependencies:\n- name: a\n  alias: b\n  version: 1.0.0\n"))
+	require.NoError(t, err, "there must be no error parsing the document")
+
+	assert.Error(t, doc.SetDependencyVersion("a", "", "1.1.0"), "a dependency with a different alias must not be matched")
+	assert.Error(t, doc.SetDependencyVersion("c", "", "1.1.0"), "an unknown dependency must not be matched")
+	assert.NoError(t, doc.SetDependencyVersion("a", "b", "1.1.0"), "the aliased dependency should be matched")
+}
+
+func TestYAMLDocumentDependencyPosition(t *testing.T) {
+	doc, err := newYAMLDocument([]byte("dependencies:\n- name: a\n  version: 1.0.0\n- name: a\n  alias: b\n  version: \"2.0.0\"\n- name: c\n"))
+	require.NoError(t, err, "there must be no error parsing the document")
+
+	line, column, err := doc.DependencyPosition("a", "")
+	require.NoError(t, err, "there should be no error finding the dependency")
+	assert.Equal(t, []int{3, 12}, []int{line, column}, "the position of the version should be returned")
+
+	line, column, err = doc.DependencyPosition("a", "b")
+	require.NoError(t, err, "there should be no error finding the aliased dependency")
+	assert.Equal(t, []int{6, 12}, []int{line, column}, "the position of the quoted version should be returned")
+
+	line, column, err = doc.DependencyPosition("c", "")
+	require.NoError(t, err, "there should be no error finding the dependency without version")
+	assert.Equal(t, []int{7, 3}, []int{line, column}, "the position of the dependency should be returned")
+
+	_, _, err = doc.DependencyPosition("d", "")
+	assert.Error(t, err, "an unknown dependency must not be found")
+}